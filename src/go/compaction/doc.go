@@ -0,0 +1,10 @@
+//Compaction of sorted tables.
+//As memtables are flushed, tables pile up and every read has to merge more of them.
+//A compaction merges a set of overlapping tables into new, non overlapping ones,
+//keeping only the newest version of every key and dropping tombstones once there's
+//no older data left for them to shadow.
+//
+//Pickers decide which tables to compact. Leveled keeps every level but the first one
+//free of overlaps and bounded in size, while SizeTiered merges runs of similarly sized tables.
+//Tables are ordered by level and then by Seq, so that a table shadows all the ones after it.
+package compaction
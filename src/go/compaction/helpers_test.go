@@ -0,0 +1,32 @@
+//Helpers for testing compactions with int Keys, see fixtures.
+package compaction
+
+import (
+	"github.com/losmonos/stork/src/go/internal/fixtures"
+	"github.com/losmonos/stork/src/go/smap"
+)
+
+type (
+	number  = fixtures.Number
+	nnCodec = fixtures.NNCodec
+)
+
+//table builds a Table description spanning [from, to].
+func table(id uint64, level int, seq uint64, from, to int, size int64) Table {
+	return Table{
+		ID:     id,
+		Level:  level,
+		Seq:    seq,
+		Bounds: smap.Interval{From: smap.Edge{Key: number(from)}, To: smap.Edge{Key: number(to)}},
+		Size:   size,
+	}
+}
+
+//ids returns the ids of the task inputs, in order.
+func ids(task *Task) []uint64 {
+	ids := []uint64{}
+	for _, t := range task.Inputs {
+		ids = append(ids, t.ID)
+	}
+	return ids
+}
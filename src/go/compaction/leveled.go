@@ -0,0 +1,115 @@
+package compaction
+
+const (
+	DefaultL0Trigger     = 4
+	DefaultBaseLevelSize = 10 << 20
+	DefaultMultiplier    = 10
+	DefaultMaxLevels     = 7
+)
+
+//Leveled is a Picker that keeps tables in levels.
+//Level 0 holds the flushed tables, which may overlap, and is compacted into level 1
+//once it holds L0Trigger tables. Every other level holds non overlapping tables and
+//is allowed BaseLevelSize bytes, times Multiplier for every level after the first one.
+//When a level grows past its limit one of its tables is merged into the next level,
+//rotating through the level key space. Zero values pick the defaults.
+type Leveled struct {
+	L0Trigger     int
+	BaseLevelSize int64
+	Multiplier    int
+	MaxLevels     int
+	//next remembers, for every level, the table after which to pick the next compaction.
+	next map[int]uint64
+}
+
+//withDefaults fills in the unset settings.
+func (l *Leveled) withDefaults() {
+	if l.L0Trigger <= 0 {
+		l.L0Trigger = DefaultL0Trigger
+	}
+	if l.BaseLevelSize <= 0 {
+		l.BaseLevelSize = DefaultBaseLevelSize
+	}
+	if l.Multiplier <= 0 {
+		l.Multiplier = DefaultMultiplier
+	}
+	if l.MaxLevels <= 1 {
+		l.MaxLevels = DefaultMaxLevels
+	}
+	if l.next == nil {
+		l.next = make(map[int]uint64)
+	}
+}
+
+//levelLimit returns the maximum size of a level >= 1.
+func (l *Leveled) levelLimit(level int) int64 {
+	limit := l.BaseLevelSize
+	for ; level > 1; level-- {
+		limit *= int64(l.Multiplier)
+	}
+	return limit
+}
+
+//Pick chooses the level 0 compaction if it's due, otherwise the level most over its limit.
+func (l *Leveled) Pick(tables []Table) *Task {
+	l.withDefaults()
+	levels := make([][]Table, l.MaxLevels)
+	for _, t := range tables {
+		if t.Level < l.MaxLevels {
+			levels[t.Level] = append(levels[t.Level], t)
+		}
+	}
+	var task *Task
+	if len(levels[0]) >= l.L0Trigger {
+		task = l.into(levels[0], levels[1], 1)
+	} else if level := l.worstLevel(levels); level > 0 {
+		task = l.into([]Table{l.rotate(level, levels[level])}, levels[level+1], level+1)
+	}
+	if task == nil {
+		return nil
+	}
+	task.DropTombstones = task.shadowsNothing(tables, func(t Table) bool { return t.Level > task.Level })
+	return task
+}
+
+//worstLevel returns the level which is the most over its limit, 0 if none is.
+//The last level has no limit.
+func (l *Leveled) worstLevel(levels [][]Table) int {
+	worst, worstScore := 0, 1.0
+	for level := 1; level < len(levels)-1; level++ {
+		size := int64(0)
+		for _, t := range levels[level] {
+			size += t.Size
+		}
+		if score := float64(size) / float64(l.levelLimit(level)); score > worstScore {
+			worst, worstScore = level, score
+		}
+	}
+	return worst
+}
+
+//rotate picks the table after the last one compacted in a level, in key order.
+func (l *Leveled) rotate(level int, tables []Table) Table {
+	sortByKey(tables)
+	chosen := tables[0]
+	last, found := l.next[level]
+	for i, t := range tables {
+		if found && t.ID == last {
+			chosen = tables[(i+1)%len(tables)]
+			break
+		}
+	}
+	l.next[level] = chosen.ID
+	return chosen
+}
+
+//into builds a task merging inputs with the tables they overlap in the next level.
+func (l *Leveled) into(inputs, next []Table, level int) *Task {
+	bounds := span(inputs)
+	for _, t := range next {
+		if t.Bounds.Overlaps(bounds) {
+			inputs = append(inputs, t)
+		}
+	}
+	return newTask(inputs, level)
+}
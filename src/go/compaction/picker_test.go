@@ -0,0 +1,92 @@
+package compaction
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLeveledL0(t *testing.T) {
+	picker := &Leveled{L0Trigger: 2}
+	tables := []Table{
+		table(1, 1, 1, 0, 10, 100),
+		table(2, 1, 1, 20, 30, 100),
+		table(3, 1, 1, 40, 50, 100),
+		table(4, 0, 4, 5, 15, 10),
+	}
+	if task := picker.Pick(tables); task != nil {
+		t.Fatalf("Expected no compaction below the trigger, got %v", ids(task))
+	}
+	tables = append(tables, table(5, 0, 5, 12, 25, 10))
+	task := picker.Pick(tables)
+	if task == nil {
+		t.Fatalf("Expected a level 0 compaction")
+	}
+	if got := fmt.Sprint(ids(task)); got != "[4 5 1 2]" {
+		t.Fatalf("Expected level 0 and its overlapping level 1 tables, got %s", got)
+	}
+	if task.Level != 1 || task.Seq != 5 || !task.DropTombstones {
+		t.Fatalf("Unexpected task %+v", task)
+	}
+}
+
+func TestLeveledOverLimit(t *testing.T) {
+	picker := &Leveled{BaseLevelSize: 100, Multiplier: 10}
+	tables := []Table{
+		table(1, 1, 1, 0, 10, 60),
+		table(2, 1, 1, 20, 30, 60),
+		table(3, 2, 1, 5, 25, 60),
+		table(4, 3, 1, 0, 100, 60),
+	}
+	task := picker.Pick(tables)
+	if task == nil {
+		t.Fatalf("Expected level 1 to be compacted")
+	}
+	if got := fmt.Sprint(ids(task)); got != "[1 3]" {
+		t.Fatalf("Expected table 1 and its overlapping level 2 table, got %s", got)
+	}
+	if task.Level != 2 || task.DropTombstones {
+		t.Fatalf("Expected a level 2 task keeping tombstones, got %+v", task)
+	}
+	//the next pick should rotate to the next table in the level
+	if task := picker.Pick(tables); task == nil || fmt.Sprint(ids(task)) != "[2 3]" {
+		t.Fatalf("Expected the next compaction to pick table 2")
+	}
+}
+
+func TestSizeTiered(t *testing.T) {
+	picker := &SizeTiered{MinThreshold: 3}
+	tables := []Table{
+		table(1, 0, 1, 0, 100, 1000),
+		table(2, 0, 2, 0, 100, 100),
+		table(3, 0, 3, 0, 100, 110),
+		table(4, 0, 4, 0, 100, 90),
+		table(5, 0, 5, 0, 100, 10),
+	}
+	task := picker.Pick(tables)
+	if task == nil {
+		t.Fatalf("Expected a bucket to be found")
+	}
+	if got := fmt.Sprint(ids(task)); got != "[4 3 2]" {
+		t.Fatalf("Expected the similarly sized tables, got %s", got)
+	}
+	if task.Seq != 4 || task.DropTombstones {
+		t.Fatalf("Expected a task with Seq 4 keeping tombstones, got %+v", task)
+	}
+	tables[0] = table(1, 0, 1, 200, 300, 1000)
+	if task := picker.Pick(tables); task == nil || !task.DropTombstones {
+		t.Fatalf("Expected tombstones to be dropped when older tables don't overlap")
+	}
+}
+
+func TestSizeTieredRuns(t *testing.T) {
+	picker := &SizeTiered{MinThreshold: 2}
+	tables := []Table{
+		table(1, 0, 1, 0, 10, 50),
+		table(2, 0, 1, 11, 20, 50),
+		table(3, 0, 2, 0, 20, 100),
+	}
+	task := picker.Pick(tables)
+	if task == nil || len(task.Inputs) != 3 {
+		t.Fatalf("Expected the tables of a run to be picked together")
+	}
+}
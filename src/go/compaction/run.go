@@ -0,0 +1,120 @@
+package compaction
+
+import (
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/sstable"
+	"time"
+)
+
+//Stats accumulates what compactions did.
+//Shadowed counts the old versions dropped because a newer input held the same key.
+type Stats struct {
+	Compactions       int
+	TablesIn          int
+	TablesOut         int
+	BytesIn           int64
+	BytesOut          int64
+	EntriesIn         int64
+	EntriesOut        int64
+	Shadowed          int64
+	TombstonesDropped int64
+	Duration          time.Duration
+}
+
+//Add accumulates other into s.
+func (s *Stats) Add(other Stats) {
+	s.Compactions += other.Compactions
+	s.TablesIn += other.TablesIn
+	s.TablesOut += other.TablesOut
+	s.BytesIn += other.BytesIn
+	s.BytesOut += other.BytesOut
+	s.EntriesIn += other.EntriesIn
+	s.EntriesOut += other.EntriesOut
+	s.Shadowed += other.Shadowed
+	s.TombstonesDropped += other.TombstonesDropped
+	s.Duration += other.Duration
+}
+
+//Output creates the tables written by a compaction.
+type Output interface {
+	//Create starts a new table.
+	Create() (*sstable.Writer, error)
+	//Commit finishes the table started by the last Create(), once its Writer is closed.
+	Commit() error
+}
+
+//countingIterator counts the entries read from a source.
+type countingIterator struct {
+	smap.TombstoneIterator
+	count *int64
+}
+
+func (c countingIterator) Next() bool {
+	if c.TombstoneIterator.Next() {
+		*c.count++
+		return true
+	}
+	return false
+}
+
+//Run executes a task. open is called for every input and must return an iterator over
+//all of its entries, tombstones included. The merged entries are written to tables created
+//by out, which are split once they hold about targetSize bytes.
+//If op is set, merge operands are folded into the older values of their keys. Operands left
+//over are fully merged when the task drops tombstones, as there's nothing older to apply them to.
+func Run(task *Task, open func(Table) smap.TombstoneIterator, out Output, targetSize int64, op smap.MergeOperator) (Stats, error) {
+	start := time.Now()
+	stats := Stats{Compactions: 1, TablesIn: len(task.Inputs)}
+	inputs := append([]Table{}, task.Inputs...)
+	Sort(inputs)
+	sources := make([]smap.Iterator, len(inputs))
+	for i, t := range inputs {
+		stats.BytesIn += t.Size
+		sources[i] = countingIterator{open(t), &stats.EntriesIn}
+	}
+	merged := smap.NewMergeIterator(sources, smap.MergeOptions{Tombstones: true, Operator: op})
+	var w *sstable.Writer
+	finish := func() error {
+		stats.TablesOut++
+		stats.BytesOut += w.Size()
+		err := w.Close()
+		if err == nil {
+			err = out.Commit()
+		}
+		w = nil
+		return err
+	}
+	for merged.Next() {
+		if merged.Tombstone() && task.DropTombstones {
+			stats.TombstonesDropped++
+			continue
+		}
+		value := merged.Value()
+		if operands, ok := value.(smap.Operands); ok && op != nil && task.DropTombstones {
+			value = op.FullMerge(merged.Key(), nil, false, operands)
+		}
+		if w == nil {
+			var err error
+			if w, err = out.Create(); err != nil {
+				return stats, err
+			}
+		}
+		if err := w.Add(merged.Key(), value, merged.Tombstone()); err != nil {
+			return stats, err
+		}
+		stats.EntriesOut++
+		if w.Size() >= targetSize {
+			if err := finish(); err != nil {
+				return stats, err
+			}
+		}
+	}
+	if w != nil {
+		if err := finish(); err != nil {
+			return stats, err
+		}
+	}
+	stats.Shadowed = stats.EntriesIn - stats.EntriesOut - stats.TombstonesDropped
+	stats.Duration = time.Since(start)
+	return stats, nil
+}
@@ -0,0 +1,123 @@
+package compaction
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/sstable"
+	"testing"
+)
+
+var testOptions = sstable.Options{Codec: nnCodec{}, BlockSize: 64}
+
+//memOutput keeps the output tables in memory.
+type memOutput struct {
+	buffers []*bytes.Buffer
+}
+
+func (m *memOutput) Create() (*sstable.Writer, error) {
+	m.buffers = append(m.buffers, &bytes.Buffer{})
+	return sstable.NewWriter(m.buffers[len(m.buffers)-1], testOptions), nil
+}
+
+func (m *memOutput) Commit() error { return nil }
+
+//readers opens the output tables.
+func (m *memOutput) readers(t *testing.T) []*sstable.Reader {
+	readers := []*sstable.Reader{}
+	for _, buf := range m.buffers {
+		r, err := sstable.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), testOptions)
+		if err != nil {
+			t.Fatalf("Unexpected error opening output: %s", err)
+		}
+		readers = append(readers, r)
+	}
+	return readers
+}
+
+//memTable writes a table from a list of keys, negative keys are tombstones. Values are the table id.
+func memTable(t *testing.T, id int, keys ...int) *sstable.Reader {
+	var buf bytes.Buffer
+	w := sstable.NewWriter(&buf, testOptions)
+	for _, k := range keys {
+		if k < 0 {
+			w.Add(number(-k), nil, true)
+		} else {
+			w.Add(number(k), id, false)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := sstable.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+//collect drains an iterator into a string, marking tombstones.
+func collect(it smap.TombstoneIterator) string {
+	var buf bytes.Buffer
+	for it.Next() {
+		if it.Tombstone() {
+			fmt.Fprintf(&buf, "%v! ", it.Key())
+		} else {
+			fmt.Fprintf(&buf, "%v=%v ", it.Key(), it.Value())
+		}
+	}
+	return buf.String()
+}
+
+func runTask(t *testing.T, drop bool) (Stats, []*sstable.Reader) {
+	inputs := map[uint64]*sstable.Reader{
+		1: memTable(t, 1, 1, 2, 3, 4, 5, 6, 7, 8),
+		2: memTable(t, 2, -2, 4, -9),
+		3: memTable(t, 3, 2, 10),
+	}
+	task := &Task{
+		Inputs:         []Table{table(1, 1, 1, 1, 8, 100), table(3, 0, 3, 2, 10, 10), table(2, 0, 2, 2, 9, 10)},
+		Level:          1,
+		DropTombstones: drop,
+	}
+	out := &memOutput{}
+	open := func(t Table) smap.TombstoneIterator { return inputs[t.ID].RangeWithTombstones(smap.Interval{}) }
+	stats, err := Run(task, open, out, 20, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error running the task: %s", err)
+	}
+	return stats, out.readers(t)
+}
+
+func TestRun(t *testing.T) {
+	stats, outputs := runTask(t, false)
+	if len(outputs) < 2 {
+		t.Fatalf("Expected the output to be split, got %d tables", len(outputs))
+	}
+	sources := []smap.Iterator{}
+	all := ""
+	for _, r := range outputs {
+		sources = append(sources, r.RangeWithTombstones(smap.Interval{}))
+		all += collect(r.RangeWithTombstones(smap.Interval{}))
+	}
+	if expected := "1=1 2=3 3=1 4=2 5=1 6=1 7=1 8=1 9! 10=3 "; all != expected {
+		t.Fatalf("Expected %q, got %q", expected, all)
+	}
+	if stats.EntriesIn != 13 || stats.EntriesOut != 10 || stats.Shadowed != 3 || stats.TablesIn != 3 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestRunDropTombstones(t *testing.T) {
+	stats, outputs := runTask(t, true)
+	all := ""
+	for _, r := range outputs {
+		all += collect(r.RangeWithTombstones(smap.Interval{}))
+	}
+	if expected := "1=1 2=3 3=1 4=2 5=1 6=1 7=1 8=1 10=3 "; all != expected {
+		t.Fatalf("Expected %q, got %q", expected, all)
+	}
+	if stats.TombstonesDropped != 1 {
+		t.Fatalf("Expected 1 dropped tombstone, got %d", stats.TombstonesDropped)
+	}
+}
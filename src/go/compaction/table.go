@@ -0,0 +1,100 @@
+package compaction
+
+import (
+	"github.com/losmonos/stork/src/go/smap"
+	"sort"
+)
+
+//Table describes a table for the pickers.
+//Seq grows with recency: within a level, a table with a greater Seq shadows the older ones.
+//Tables written by the same compaction share their Seq and don't overlap.
+//Bounds is the closed interval between the first and the last key in the table, tombstones included.
+type Table struct {
+	ID     uint64
+	Level  int
+	Seq    uint64
+	Bounds smap.Interval
+	Size   int64
+}
+
+//Task is a compaction: the Inputs are merged into tables at the output Level.
+//DropTombstones tells whether there's no older data the inputs' tombstones could shadow.
+//Seq is the recency of the outputs, the newest among the inputs.
+type Task struct {
+	Inputs         []Table
+	Level          int
+	Seq            uint64
+	DropTombstones bool
+}
+
+//Picker chooses the next compaction for a set of tables, or returns nil if there's nothing to do.
+type Picker interface {
+	Pick(tables []Table) *Task
+}
+
+//Newer tells whether a comes before b in the read order: by level and then by descending Seq.
+func Newer(a, b Table) bool {
+	if a.Level != b.Level {
+		return a.Level < b.Level
+	}
+	return a.Seq > b.Seq
+}
+
+//Sort orders tables from newest to oldest.
+func Sort(tables []Table) {
+	sort.SliceStable(tables, func(i, j int) bool { return Newer(tables[i], tables[j]) })
+}
+
+//sortByKey orders tables by their first key.
+func sortByKey(tables []Table) {
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].Bounds.From.Key.Cmp(tables[j].Bounds.From.Key) < 0
+	})
+}
+
+//span returns the smallest interval holding all the tables bounds.
+func span(tables []Table) smap.Interval {
+	i := tables[0].Bounds
+	for _, t := range tables[1:] {
+		if t.Bounds.From.Key.Cmp(i.From.Key) < 0 {
+			i.From = t.Bounds.From
+		}
+		if t.Bounds.To.Key.Cmp(i.To.Key) > 0 {
+			i.To = t.Bounds.To
+		}
+	}
+	return i
+}
+
+//newTask builds a task, setting its Seq from the inputs.
+func newTask(inputs []Table, level int) *Task {
+	task := &Task{Inputs: inputs, Level: level}
+	for _, t := range inputs {
+		if t.Seq > task.Seq {
+			task.Seq = t.Seq
+		}
+	}
+	return task
+}
+
+//Contains tells whether a table is among the task inputs.
+func (task *Task) Contains(t Table) bool {
+	for _, input := range task.Inputs {
+		if input.ID == t.ID {
+			return true
+		}
+	}
+	return false
+}
+
+//shadowsNothing tells whether the task's tombstones can be dropped:
+//no table older than the inputs overlaps them. older tells whether a table is older than the outputs.
+func (task *Task) shadowsNothing(tables []Table, older func(Table) bool) bool {
+	bounds := span(task.Inputs)
+	for _, t := range tables {
+		if !task.Contains(t) && older(t) && t.Bounds.Overlaps(bounds) {
+			return false
+		}
+	}
+	return true
+}
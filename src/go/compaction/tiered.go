@@ -0,0 +1,104 @@
+package compaction
+
+import (
+	"sort"
+)
+
+const (
+	DefaultMinThreshold = 4
+	DefaultMaxThreshold = 32
+	DefaultBucketLow    = 0.5
+	DefaultBucketHigh   = 1.5
+)
+
+//SizeTiered is a Picker that merges runs of tables of similar size.
+//A run is the set of tables written by a flush or a compaction, which share their Seq.
+//Runs are only merged with the runs next to them in recency, so the output can take their place.
+//A bucket is a sequence of at least MinThreshold and at most MaxThreshold runs which sizes are
+//within BucketLow and BucketHigh times the bucket average. Zero values pick the defaults.
+//All the tables are kept in level 0.
+type SizeTiered struct {
+	MinThreshold          int
+	MaxThreshold          int
+	BucketLow, BucketHigh float64
+}
+
+//withDefaults fills in the unset settings.
+func (s *SizeTiered) withDefaults() {
+	if s.MinThreshold < 2 {
+		s.MinThreshold = DefaultMinThreshold
+	}
+	if s.MaxThreshold < s.MinThreshold {
+		s.MaxThreshold = DefaultMaxThreshold
+	}
+	if s.BucketLow <= 0 {
+		s.BucketLow = DefaultBucketLow
+	}
+	if s.BucketHigh <= 0 {
+		s.BucketHigh = DefaultBucketHigh
+	}
+}
+
+//run is a set of tables sharing their Seq.
+type run struct {
+	tables []Table
+	size   int64
+}
+
+//Pick chooses the first bucket of runs, from newest to oldest.
+func (s *SizeTiered) Pick(tables []Table) *Task {
+	s.withDefaults()
+	runs := runs(tables)
+	for start := 0; start+s.MinThreshold <= len(runs); start++ {
+		end, total := start, int64(0)
+		for end < len(runs) && end-start < s.MaxThreshold {
+			average := float64(total+runs[end].size) / float64(end-start+1)
+			if !s.fits(runs[start:end+1], average) {
+				break
+			}
+			total += runs[end].size
+			end++
+		}
+		if end-start >= s.MinThreshold {
+			inputs := []Table{}
+			for _, r := range runs[start:end] {
+				inputs = append(inputs, r.tables...)
+			}
+			task := newTask(inputs, 0)
+			oldest := runs[end-1].tables[0].Seq
+			task.DropTombstones = task.shadowsNothing(tables, func(t Table) bool { return t.Seq < oldest })
+			return task
+		}
+	}
+	return nil
+}
+
+//fits tells whether all the runs are within the bucket bounds for the given average size.
+func (s *SizeTiered) fits(runs []run, average float64) bool {
+	for _, r := range runs {
+		if float64(r.size) < average*s.BucketLow || float64(r.size) > average*s.BucketHigh {
+			return false
+		}
+	}
+	return true
+}
+
+//runs groups tables by Seq, from newest to oldest.
+func runs(tables []Table) []run {
+	bySeq := map[uint64]*run{}
+	for _, t := range tables {
+		r, ok := bySeq[t.Seq]
+		if !ok {
+			r = &run{}
+			bySeq[t.Seq] = r
+		}
+		r.tables = append(r.tables, t)
+		r.size += t.Size
+	}
+	runs := make([]run, 0, len(bySeq))
+	for _, r := range bySeq {
+		runs = append(runs, *r)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].tables[0].Seq > runs[j].tables[0].Seq })
+	return runs
+}
@@ -0,0 +1,105 @@
+//Keys, entries and codecs shared by the tests of the packages built on top of redblack.
+//Str keys map to string values and Number keys to int values.
+//
+//This package is test-only: it must only be imported from _test.go files, which
+//alias its types under the names their tests use, see helpers_test.go in wal or stork.
+package fixtures
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/smap/redblack"
+)
+
+type Str string
+
+//Cmp compares two string Keys
+func (s Str) Cmp(other smap.Key) int {
+	return bytes.Compare([]byte(string(s)), []byte(string(other.(Str))))
+}
+
+//SS implements a string to string Entry
+type SS struct {
+	key   Str
+	value string
+}
+
+func (e *SS) GetKey() smap.Key { return e.key }
+
+func (e *SS) GetValue() smap.Value { return e.value }
+
+func (e *SS) SetValue(v smap.Value) { e.value = v.(string) }
+
+func (e *SS) Size() int { return len(e.key) + len(e.value) }
+
+func (e *SS) Empty() bool { return false }
+
+func SSFactory(key smap.Key, value smap.Value) redblack.Entry {
+	return &SS{key.(Str), value.(string)}
+}
+
+//StrCodec encodes Str keys and string values as their raw bytes.
+type StrCodec struct{}
+
+func (StrCodec) EncodeKey(k smap.Key) ([]byte, error) { return []byte(k.(Str)), nil }
+
+func (StrCodec) DecodeKey(b []byte) (smap.Key, error) { return Str(b), nil }
+
+func (StrCodec) EncodeValue(v smap.Value) ([]byte, error) { return []byte(v.(string)), nil }
+
+func (StrCodec) DecodeValue(b []byte) (smap.Value, error) { return string(b), nil }
+
+type Number int
+
+//Cmp compares to int Keys
+func (n Number) Cmp(other smap.Key) int {
+	return int(n) - int(other.(Number))
+}
+
+//NN implements a int(Number) to int Entry
+type NN struct {
+	key   Number
+	value int
+}
+
+func (e *NN) GetKey() smap.Key { return e.key }
+
+func (e *NN) GetValue() smap.Value { return e.value }
+
+func (e *NN) SetValue(v smap.Value) { e.value = v.(int) }
+
+func (e *NN) Size() int { return 16 }
+
+func (e *NN) Empty() bool { return false }
+
+func NNFactory(key smap.Key, value smap.Value) redblack.Entry {
+	return &NN{key.(Number), value.(int)}
+}
+
+//NNCodec encodes Number keys and int values as varints.
+type NNCodec struct{}
+
+func (NNCodec) EncodeKey(k smap.Key) ([]byte, error) {
+	return binary.AppendVarint(nil, int64(k.(Number))), nil
+}
+
+func (NNCodec) DecodeKey(b []byte) (smap.Key, error) {
+	v, _ := binary.Varint(b)
+	return Number(v), nil
+}
+
+func (NNCodec) EncodeValue(v smap.Value) ([]byte, error) {
+	return binary.AppendVarint(nil, int64(v.(int))), nil
+}
+
+func (NNCodec) DecodeValue(b []byte) (smap.Value, error) {
+	v, _ := binary.Varint(b)
+	return int(v), nil
+}
+
+//enforce the codecs implement Codec
+var (
+	_ smap.Codec = StrCodec{}
+	_ smap.Codec = NNCodec{}
+)
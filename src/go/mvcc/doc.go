@@ -0,0 +1,16 @@
+//Multi-version concurrency control on top of a sorted map.
+//Every write gets a monotonically increasing sequence number and is stored as a new version,
+//under an InternalKey made of the user key and the sequence number. Internal keys sort by
+//user key and then newest first, so the versions of a key are adjacent and the one visible
+//at a given sequence number is the first one not newer than it.
+//
+//Reads see the store as it was at a sequence number. Snapshots pin the sequence number
+//they were taken at, and the versions that no snapshot can see anymore are dropped as
+//keys are written again, or all at once by GC().
+//
+//Transactions (see Begin) read at a snapshot and buffer their writes, which are committed
+//as a batch unless someone else wrote what they read or wrote in the meantime.
+//
+//The versions can be kept in any smap.SMap: a RedBlack using NewFactory,
+//or a stork DB using NewFactory and NewCodec.
+package mvcc
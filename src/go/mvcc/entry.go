@@ -0,0 +1,48 @@
+package mvcc
+
+import (
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/smap/redblack"
+)
+
+//version is the Entry of a version: the user entry, or nil for deletions.
+type version struct {
+	key  InternalKey
+	user redblack.Entry
+}
+
+func (e *version) GetKey() smap.Key { return e.key }
+
+func (e *version) GetValue() smap.Value {
+	if e.user == nil {
+		return deletion{}
+	}
+	return e.user.GetValue()
+}
+
+//SetValue is never called on versions, as every write has its own internal key.
+func (e *version) SetValue(v smap.Value) { panic("SetValue on a version") }
+
+//Size is the size of the user entry plus the sequence number.
+func (e *version) Size() int {
+	if e.user == nil {
+		return 8
+	}
+	return e.user.Size() + 8
+}
+
+func (e *version) Empty() bool { return false }
+
+//NewFactory returns an EntryFactory for versions, given the one for the user keys and values.
+func NewFactory(user redblack.EntryFactory) redblack.EntryFactory {
+	return func(key smap.Key, value smap.Value) redblack.Entry {
+		internal := key.(InternalKey)
+		if _, ok := value.(deletion); ok {
+			return &version{internal, nil}
+		}
+		return &version{internal, user(internal.Key, value)}
+	}
+}
+
+//enforce version implements Entry
+var _ redblack.Entry = &version{}
@@ -0,0 +1,13 @@
+//Helpers for testing Stores with int Keys, see fixtures.
+package mvcc
+
+import (
+	"github.com/losmonos/stork/src/go/internal/fixtures"
+)
+
+type (
+	number  = fixtures.Number
+	nnCodec = fixtures.NNCodec
+)
+
+var nnFactory = fixtures.NNFactory
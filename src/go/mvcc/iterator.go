@@ -0,0 +1,74 @@
+package mvcc
+
+import (
+	"github.com/losmonos/stork/src/go/smap"
+	"io"
+)
+
+//Iterator visits the user keys of a range of versions, along with their values visible at seq.
+//Newer versions are skipped, then the first one found is the visible one and the rest are skipped too.
+//Keys whose visible version is a deletion are skipped altogether.
+type Iterator struct {
+	it      smap.Iterator
+	seq     uint64
+	visible smap.Key
+	key     smap.Key
+	value   smap.Value
+}
+
+//Next advances the iterator one step and if returns true, an entry will be available upon calling Key() and Value()
+func (i *Iterator) Next() bool {
+	for i.it.Next() {
+		if i.visit() {
+			return true
+		}
+	}
+	return false
+}
+
+//Seek moves the iterator to the first user key >= key, see smap.SeekableIterator.
+//It panics if the versions iterator doesn't implement smap.SeekableIterator.
+func (i *Iterator) Seek(key smap.Key) bool {
+	i.visible = nil
+	if !i.it.(smap.SeekableIterator).Seek(InternalKey{key, MaxSeq}) {
+		return false
+	}
+	return i.visit() || i.Next()
+}
+
+//visit tells whether the current version is the visible one of a user key which isn't deleted,
+//making it the current entry.
+func (i *Iterator) visit() bool {
+	k := i.it.Key().(InternalKey)
+	if k.Seq > i.seq || (i.visible != nil && i.visible.Cmp(k.Key) == 0) {
+		return false
+	}
+	i.visible = k.Key
+	v := i.it.Value()
+	if _, deleted := v.(deletion); deleted {
+		return false
+	}
+	i.key, i.value = k.Key, v
+	return true
+}
+
+//Key returns the current user key in the iterator.
+func (i *Iterator) Key() smap.Key {
+	return i.key
+}
+
+//Value returns the current value in the iterator.
+func (i *Iterator) Value() smap.Value {
+	return i.value
+}
+
+//Close closes the versions iterator if it implements io.Closer.
+func (i *Iterator) Close() error {
+	if closer, ok := i.it.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+//enforce Iterator implements SeekableIterator
+var _ smap.SeekableIterator = &Iterator{}
@@ -0,0 +1,113 @@
+package mvcc
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/losmonos/stork/src/go/smap"
+	"math"
+)
+
+//ErrInvalid is returned when decoding bytes that aren't a valid internal key or version.
+var ErrInvalid = errors.New("mvcc: invalid encoding")
+
+//MaxSeq is the greatest sequence number, reading at MaxSeq sees every version.
+const MaxSeq uint64 = math.MaxUint64
+
+//InternalKey identifies a version: the user key it belongs to and the sequence number of the write.
+type InternalKey struct {
+	Key smap.Key
+	Seq uint64
+}
+
+//Cmp compares the user keys, and then the sequence numbers in descending order.
+func (k InternalKey) Cmp(other smap.Key) int {
+	o := other.(InternalKey)
+	if cmp := k.Key.Cmp(o.Key); cmp != 0 {
+		return cmp
+	}
+	if k.Seq > o.Seq {
+		return -1
+	} else if k.Seq < o.Seq {
+		return 1
+	}
+	return 0
+}
+
+//deletion is the value of the versions written by Delete().
+type deletion struct{}
+
+//internalInterval returns the interval holding every version of the user keys within i.
+func internalInterval(i smap.Interval) smap.Interval {
+	internal := smap.Interval{}
+	if i.From != smap.Inf {
+		if i.From.Open {
+			//past the oldest version of the key
+			internal.From = smap.Edge{Key: InternalKey{i.From.Key, 0}, Open: true}
+		} else {
+			internal.From = smap.Edge{Key: InternalKey{i.From.Key, MaxSeq}}
+		}
+	}
+	if i.To != smap.Inf {
+		if i.To.Open {
+			//before the newest version of the key
+			internal.To = smap.Edge{Key: InternalKey{i.To.Key, MaxSeq}, Open: true}
+		} else {
+			internal.To = smap.Edge{Key: InternalKey{i.To.Key, 0}}
+		}
+	}
+	return internal
+}
+
+//codec wraps a user Codec to encode internal keys and versions.
+type codec struct {
+	user smap.Codec
+}
+
+//NewCodec returns a Codec for the internal keys and versions stored by a Store, given the user one.
+//Internal keys are encoded as the user key followed by the complemented sequence number,
+//so they keep sorting newest first. Versions are prefixed by a byte telling deletions apart.
+func NewCodec(user smap.Codec) smap.Codec {
+	return codec{user}
+}
+
+func (c codec) EncodeKey(k smap.Key) ([]byte, error) {
+	internal := k.(InternalKey)
+	b, err := c.user.EncodeKey(internal.Key)
+	if err != nil {
+		return nil, err
+	}
+	return binary.BigEndian.AppendUint64(b, ^internal.Seq), nil
+}
+
+func (c codec) DecodeKey(b []byte) (smap.Key, error) {
+	if len(b) < 8 {
+		return nil, ErrInvalid
+	}
+	split := len(b) - 8
+	key, err := c.user.DecodeKey(b[:split])
+	if err != nil {
+		return nil, err
+	}
+	return InternalKey{key, ^binary.BigEndian.Uint64(b[split:])}, nil
+}
+
+func (c codec) EncodeValue(v smap.Value) ([]byte, error) {
+	if _, ok := v.(deletion); ok {
+		return []byte{1}, nil
+	}
+	b, err := c.user.EncodeValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{0}, b...), nil
+}
+
+func (c codec) DecodeValue(b []byte) (smap.Value, error) {
+	if len(b) == 0 || b[0] > 1 {
+		return nil, ErrInvalid
+	}
+	if b[0] == 1 {
+		return deletion{}, nil
+	}
+	return c.user.DecodeValue(b[1:])
+}
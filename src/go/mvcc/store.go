@@ -0,0 +1,229 @@
+package mvcc
+
+import (
+	"github.com/losmonos/stork/src/go/smap"
+	"sort"
+	"sync"
+)
+
+//Store keeps every version of its keys in an SMap of InternalKeys, see NewFactory and NewCodec.
+//Writes are serialized, so versions are written in sequence order. Reads may run concurrently
+//with writes only if the SMap allows it, as stork DBs and concurrent Maps do.
+//snapshots counts the open snapshots by sequence number.
+type Store struct {
+	mu        sync.RWMutex
+	m         smap.SMap
+	seq       uint64
+	snapshots map[uint64]int
+}
+
+//New creates a Store on top of m, which may already hold versions from a previous Store.
+//The sequence numbers continue after the greatest one found in m.
+func New(m smap.SMap) *Store {
+	s := &Store{m: m, snapshots: map[uint64]int{}}
+	for k := range smap.All(m.Range(smap.Interval{})) {
+		if seq := k.(InternalKey).Seq; seq > s.seq {
+			s.seq = seq
+		}
+	}
+	return s
+}
+
+//Seq returns the sequence number of the latest write.
+func (s *Store) Seq() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.seq
+}
+
+//Put writes a new version of key and returns its sequence number.
+func (s *Store) Put(key smap.Key, v smap.Value) uint64 {
+	return s.write(key, v)
+}
+
+//Delete writes a deletion of key and returns its sequence number.
+//The key is not found when reading at that sequence number or later.
+func (s *Store) Delete(key smap.Key) uint64 {
+	return s.write(key, deletion{})
+}
+
+//write stores a version and drops the versions of the key no longer visible.
+func (s *Store) write(key smap.Key, v smap.Value) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	s.m.Put(InternalKey{key, s.seq}, v)
+	s.prune(key)
+	return s.seq
+}
+
+//prune drops the versions of key no longer visible. It must be called with the lock held.
+func (s *Store) prune(key smap.Key) {
+	for _, old := range s.obsolete(smap.Interval{From: smap.Edge{Key: key}, To: smap.Edge{Key: key}}) {
+		s.m.Delete(old)
+	}
+}
+
+//batcher is implemented by maps that apply batches atomically, like stork DBs.
+type batcher interface {
+	Apply(b *smap.Batch) error
+}
+
+//Apply writes the operations of a batch as new versions, under consecutive sequence numbers,
+//and returns the sequence number of the last one. Seq() moves past the batch once it's
+//all written, so reads at the current sequence number see all of it or none.
+//If the map implements Apply(*smap.Batch) error the versions are written through it,
+//atomically, and its errors are returned leaving Seq() unchanged.
+func (s *Store) Apply(b *smap.Batch) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.apply(b)
+}
+
+//apply writes a batch. It must be called with the lock held.
+func (s *Store) apply(b *smap.Batch) (uint64, error) {
+	versions := &smap.Batch{}
+	seq := s.seq
+	b.Each(func(key smap.Key, v smap.Value, deleted bool) {
+		seq++
+		if deleted {
+			v = deletion{}
+		}
+		versions.Put(InternalKey{key, seq}, v)
+	})
+	if m, ok := s.m.(batcher); ok {
+		if err := m.Apply(versions); err != nil {
+			return s.seq, err
+		}
+	} else {
+		versions.ApplyTo(s.m)
+	}
+	s.seq = seq
+	b.Each(func(key smap.Key, v smap.Value, deleted bool) { s.prune(key) })
+	return s.seq, nil
+}
+
+//Get returns the value of key visible at seq: the one of its newest version not newer than seq.
+//Versions are only kept for the sequence numbers pinned by snapshots and the latest one,
+//reading at any other sequence number may miss the versions dropped meanwhile.
+func (s *Store) Get(key smap.Key, seq uint64) (v smap.Value, found bool) {
+	k, v, found := s.m.Ceiling(InternalKey{key, seq})
+	if !found || k.(InternalKey).Key.Cmp(key) != 0 {
+		return nil, false
+	}
+	if _, deleted := v.(deletion); deleted {
+		return nil, false
+	}
+	return v, true
+}
+
+//Range returns an Iterator over the user keys within the interval and their values visible at seq, in order.
+func (s *Store) Range(i smap.Interval, seq uint64) smap.Iterator {
+	return &Iterator{it: s.m.Range(internalInterval(i)), seq: seq}
+}
+
+//Snapshot pins the current sequence number, so the versions visible at it are kept until Release().
+func (s *Store) Snapshot() *Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshots[s.seq]++
+	return &Snapshot{s: s, seq: s.seq}
+}
+
+//pinned returns the sequence numbers reads are guaranteed at, newest first:
+//the current one and those of the open snapshots. It must be called with the lock held.
+func (s *Store) pinned() []uint64 {
+	pinned := []uint64{s.seq}
+	for seq := range s.snapshots {
+		if seq != s.seq {
+			pinned = append(pinned, seq)
+		}
+	}
+	sort.Slice(pinned, func(i, j int) bool { return pinned[i] > pinned[j] })
+	return pinned
+}
+
+//obsolete returns the versions of the user keys within i that can't be read anymore.
+//A version is needed if it's the one visible at a pinned sequence number, that is,
+//some pinned number lies between its own and the one of the next newer version.
+//Deletions are needed as long as there are older versions left to shadow, and as long as
+//there are older snapshots, so transactions can tell the key was written after them.
+//It must be called with the lock held.
+func (s *Store) obsolete(i smap.Interval) []InternalKey {
+	pinned := s.pinned()
+	keys := []InternalKey{}
+	var current smap.Key
+	var p int
+	var deletions []InternalKey
+	for key, v := range smap.All(s.m.Range(internalInterval(i))) {
+		k := key.(InternalKey)
+		if current == nil || current.Cmp(k.Key) != 0 {
+			keys = append(keys, deletions...)
+			current, p, deletions = k.Key, 0, nil
+		}
+		//pinned[p] is the newest pinned number older than the previous version
+		if p == len(pinned) || pinned[p] < k.Seq {
+			keys = append(keys, k)
+			continue
+		}
+		for p < len(pinned) && pinned[p] >= k.Seq {
+			p++
+		}
+		//deletions newer than the oldest pinned number are never dropped
+		if _, deleted := v.(deletion); deleted && k.Seq <= pinned[len(pinned)-1] {
+			deletions = append(deletions, k)
+		} else {
+			deletions = nil
+		}
+	}
+	return append(keys, deletions...)
+}
+
+//GC drops all the versions that can't be read anymore, and returns how many were dropped.
+//Writes drop the versions of the keys they write, GC is meant to clean up after snapshots
+//are released and for the keys that are not written again.
+func (s *Store) GC() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := s.obsolete(smap.Interval{})
+	for _, k := range keys {
+		s.m.Delete(k)
+	}
+	return len(keys)
+}
+
+//Snapshot is a read only view of a Store at a sequence number.
+type Snapshot struct {
+	s        *Store
+	seq      uint64
+	released bool
+}
+
+//Seq returns the sequence number the snapshot reads at.
+func (snap *Snapshot) Seq() uint64 {
+	return snap.seq
+}
+
+//Get returns the value of key as it was when the snapshot was taken.
+func (snap *Snapshot) Get(key smap.Key) (v smap.Value, found bool) {
+	return snap.s.Get(key, snap.seq)
+}
+
+//Range returns an Iterator over the user keys within the interval as they were when the snapshot was taken.
+func (snap *Snapshot) Range(i smap.Interval) smap.Iterator {
+	return snap.s.Range(i, snap.seq)
+}
+
+//Release unpins the snapshot sequence number, it must be called once the snapshot is no longer used.
+//Releasing a snapshot again does nothing.
+func (snap *Snapshot) Release() {
+	snap.s.mu.Lock()
+	defer snap.s.mu.Unlock()
+	if snap.released {
+		return
+	}
+	snap.released = true
+	if snap.s.snapshots[snap.seq]--; snap.s.snapshots[snap.seq] <= 0 {
+		delete(snap.s.snapshots, snap.seq)
+	}
+}
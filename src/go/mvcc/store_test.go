@@ -0,0 +1,249 @@
+package mvcc
+
+import (
+	"errors"
+	"fmt"
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/smap/redblack"
+	"github.com/losmonos/stork/src/go/stork"
+	"math/rand"
+	"testing"
+)
+
+//render lists the keys and values of an iterator.
+func render(it smap.Iterator) string {
+	s := ""
+	for k, v := range smap.All(it) {
+		s += fmt.Sprint(k, ":", v, " ")
+	}
+	return s
+}
+
+//renderModel lists the keys in [0, n) of a model in order.
+func renderModel(model map[int]int, n int) string {
+	s := ""
+	for k := 0; k < n; k++ {
+		if v, ok := model[k]; ok {
+			s += fmt.Sprint(k, ":", v, " ")
+		}
+	}
+	return s
+}
+
+func TestSnapshotReads(t *testing.T) {
+	s := New(redblack.New(NewFactory(nnFactory)))
+	r := rand.New(rand.NewSource(1))
+	model := map[int]int{}
+	snapshots := []*Snapshot{}
+	models := []map[int]int{}
+	for i := 0; i < 3000; i++ {
+		k := r.Intn(100)
+		if r.Intn(3) == 0 {
+			s.Delete(number(k))
+			delete(model, k)
+		} else {
+			s.Put(number(k), i)
+			model[k] = i
+		}
+		if i%200 == 0 {
+			snapshots = append(snapshots, s.Snapshot())
+			copied := map[int]int{}
+			for k, v := range model {
+				copied[k] = v
+			}
+			models = append(models, copied)
+		}
+	}
+	snapshots = append(snapshots, s.Snapshot())
+	models = append(models, model)
+	for j, snap := range snapshots {
+		for k := 0; k < 100; k++ {
+			expected, expectedFound := models[j][k]
+			if v, found := snap.Get(number(k)); found != expectedFound || (found && v != expected) {
+				t.Fatalf("Expected %d, %v for %d in snapshot %d, got %v, %v", expected, expectedFound, k, j, v, found)
+			}
+		}
+		if expected, got := renderModel(models[j], 100), render(snap.Range(smap.Interval{})); got != expected {
+			t.Fatalf("Range mismatch in snapshot %d:\nexpected %s\ngot      %s", j, expected, got)
+		}
+	}
+	i := smap.Interval{From: smap.Edge{Key: number(20), Open: true}, To: smap.Edge{Key: number(80)}}
+	expected := ""
+	for k := 21; k <= 80; k++ {
+		if v, ok := model[k]; ok {
+			expected += fmt.Sprint(k, ":", v, " ")
+		}
+	}
+	if got := render(s.Range(i, s.Seq())); got != expected {
+		t.Fatalf("Interval mismatch:\nexpected %s\ngot      %s", expected, got)
+	}
+}
+
+func TestVersionsDropped(t *testing.T) {
+	m := redblack.New(NewFactory(nnFactory))
+	s := New(m)
+	for i := 0; i < 10; i++ {
+		s.Put(number(1), i)
+		s.Put(number(2), i)
+	}
+	s.Delete(number(2))
+	if m.Len() != 1 {
+		t.Fatalf("Expected writes to keep just the latest version, got %d versions", m.Len())
+	}
+
+	snap := s.Snapshot()
+	for i := 0; i < 10; i++ {
+		s.Put(number(1), 10+i)
+		s.Put(number(3), i)
+	}
+	s.Delete(number(3))
+	//the snapshot holds 1:9, and no version of 3 was visible at it
+	//but its deletion is kept to tell it was written since
+	if m.Len() != 3 {
+		t.Fatalf("Expected 3 versions, got %d", m.Len())
+	}
+	if v, _ := snap.Get(number(1)); v != 9 {
+		t.Fatalf("Expected the snapshot to read 9, got %v", v)
+	}
+	if dropped := s.GC(); dropped != 0 {
+		t.Fatalf("Expected GC to keep everything while the snapshot is open, dropped %d", dropped)
+	}
+	snap.Release()
+	if dropped := s.GC(); dropped != 2 {
+		t.Fatalf("Expected GC to drop 2 versions, dropped %d", dropped)
+	}
+	if got := render(s.Range(smap.Interval{}, s.Seq())); got != "1:19 " {
+		t.Fatalf("Expected 1:19, got %s", got)
+	}
+}
+
+func TestReleaseTwice(t *testing.T) {
+	s := New(redblack.New(NewFactory(nnFactory)))
+	s.Put(number(1), 1)
+	first, second := s.Snapshot(), s.Snapshot()
+	first.Release()
+	first.Release()
+	s.Put(number(1), 2)
+	s.GC()
+	if v, _ := second.Get(number(1)); v != 1 {
+		t.Fatalf("Expected the second snapshot to still read 1, got %v", v)
+	}
+	second.Release()
+	second.Release()
+	if len(s.snapshots) != 0 {
+		t.Fatalf("Expected no snapshots left, got %v", s.snapshots)
+	}
+}
+
+func TestApplyBatch(t *testing.T) {
+	s := New(redblack.New(NewFactory(nnFactory)))
+	s.Put(number(1), 1)
+	before := s.Seq()
+	b := &smap.Batch{}
+	b.Put(number(2), 2)
+	b.Delete(number(1))
+	b.Put(number(3), 3)
+	if seq, err := s.Apply(b); err != nil || seq != before+3 || s.Seq() != seq {
+		t.Fatalf("Expected the batch to take sequence numbers up to %d, got %d, %v", before+3, seq, err)
+	}
+	if got := render(s.Range(smap.Interval{}, s.Seq())); got != "2:2 3:3 " {
+		t.Fatalf("Expected 2:2 3:3, got %s", got)
+	}
+}
+
+//failing is a map which batches fail to apply.
+type failing struct {
+	*redblack.RedBlack
+}
+
+var errFailing = errors.New("failing")
+
+func (failing) Apply(b *smap.Batch) error { return errFailing }
+
+func TestApplyError(t *testing.T) {
+	s := New(failing{redblack.New(NewFactory(nnFactory))})
+	s.Put(number(1), 1)
+	b := &smap.Batch{}
+	b.Put(number(1), 2)
+	if seq, err := s.Apply(b); err != errFailing || seq != 1 || s.Seq() != 1 {
+		t.Fatalf("Expected the batch to fail leaving the sequence number at 1, got %d, %v", s.Seq(), err)
+	}
+	txn := s.Begin()
+	txn.Put(number(1), 3)
+	if err := txn.Commit(); err != errFailing || s.Seq() != 1 {
+		t.Fatalf("Expected the commit to fail leaving the sequence number at 1, got %d, %v", s.Seq(), err)
+	}
+	if v, _ := s.Get(number(1), s.Seq()); v != 1 {
+		t.Fatalf("Expected 1, got %v", v)
+	}
+}
+
+func TestPersistedVersions(t *testing.T) {
+	dir := t.TempDir()
+	opts := stork.Options{Codec: NewCodec(nnCodec{}), Factory: NewFactory(nnFactory), MemtableSize: 1024}
+	db, err := stork.Open(dir, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error opening: %s", err)
+	}
+	s := New(db)
+	for i := 0; i < 450; i++ {
+		s.Put(number(i%50), i)
+	}
+	//the last 50 writes go through the DB in a single batch
+	b := &smap.Batch{}
+	for i := 450; i < 500; i++ {
+		b.Put(number(i%50), i)
+	}
+	if _, err := s.Apply(b); err != nil {
+		t.Fatalf("Unexpected error applying: %s", err)
+	}
+	s.Delete(number(0))
+	seq := s.Seq()
+	if err := db.Close(); err != nil {
+		t.Fatalf("Unexpected error closing: %s", err)
+	}
+
+	db, err = stork.Open(dir, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error reopening: %s", err)
+	}
+	defer db.Close()
+	s = New(db)
+	//the deletion was the latest write, but there was nothing left for it to shadow
+	if s.Seq() != seq-1 {
+		t.Fatalf("Expected the sequence numbers to continue after %d, got %d", seq-1, s.Seq())
+	}
+	if _, found := s.Get(number(0), seq); found {
+		t.Fatalf("Expected 0 to be deleted")
+	}
+	for k := 1; k < 50; k++ {
+		if v, found := s.Get(number(k), seq); !found || v != 450+k {
+			t.Fatalf("Expected %d for %d, got %v, %v", 450+k, k, v, found)
+		}
+	}
+}
+
+func TestCodec(t *testing.T) {
+	c := NewCodec(nnCodec{})
+	for _, k := range []InternalKey{{number(0), 0}, {number(-5), 7}, {number(300), MaxSeq}} {
+		b, err := c.EncodeKey(k)
+		if err != nil {
+			t.Fatalf("Unexpected error encoding %v: %s", k, err)
+		}
+		if decoded, err := c.DecodeKey(b); err != nil || decoded != k {
+			t.Fatalf("Expected %v, got %v, %v", k, decoded, err)
+		}
+	}
+	for _, v := range []smap.Value{deletion{}, 0, -1} {
+		b, _ := c.EncodeValue(v)
+		if decoded, err := c.DecodeValue(b); err != nil || decoded != v {
+			t.Fatalf("Expected %v, got %v, %v", v, decoded, err)
+		}
+	}
+	if _, err := c.DecodeKey([]byte{1}); err != ErrInvalid {
+		t.Fatalf("Expected ErrInvalid, got %v", err)
+	}
+	if _, err := c.DecodeValue([]byte{2}); err != ErrInvalid {
+		t.Fatalf("Expected ErrInvalid, got %v", err)
+	}
+}
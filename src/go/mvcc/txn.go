@@ -0,0 +1,132 @@
+package mvcc
+
+import (
+	"errors"
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/smap/redblack"
+)
+
+var (
+	//ErrConflict is returned by Commit when another transaction wrote what the transaction read or wrote.
+	ErrConflict = errors.New("mvcc: transaction conflict")
+	//ErrDone is returned when committing a transaction that was already committed or rolled back.
+	ErrDone = errors.New("mvcc: transaction done")
+)
+
+//pending is the Entry of a write buffered in a transaction.
+type pending struct {
+	key   smap.Key
+	value smap.Value
+}
+
+func (e *pending) GetKey() smap.Key { return e.key }
+
+func (e *pending) GetValue() smap.Value { return e.value }
+
+func (e *pending) SetValue(v smap.Value) { e.value = v }
+
+func (e *pending) Size() int { return 0 }
+
+func (e *pending) Empty() bool { return false }
+
+func pendingFactory(key smap.Key, value smap.Value) redblack.Entry {
+	return &pending{key, value}
+}
+
+//Txn is an optimistic transaction: it reads at a snapshot and buffers its writes, which are
+//applied on Commit as a single batch. Reads see the buffered writes over the snapshot.
+//The intervals read and the keys written are tracked, and Commit fails with ErrConflict if any
+//of them was written by someone else since the snapshot was taken, which makes transactions
+//serializable. A Txn is meant to be used by a single goroutine.
+type Txn struct {
+	s      *Store
+	snap   *Snapshot
+	writes *redblack.RedBlack
+	reads  []smap.Interval
+	done   bool
+}
+
+//Begin starts a transaction reading at the current sequence number.
+//It must be ended by Commit or Rollback, as its snapshot keeps old versions around.
+func (s *Store) Begin() *Txn {
+	return &Txn{s: s, snap: s.Snapshot(), writes: redblack.NewWithTombstones(pendingFactory)}
+}
+
+//Get returns the value of key as written by the transaction, or else as in its snapshot.
+func (t *Txn) Get(key smap.Key) (v smap.Value, found bool) {
+	if v, deleted, found := t.writes.Lookup(key); found {
+		return v, !deleted
+	}
+	t.reads = append(t.reads, smap.Interval{From: smap.Edge{Key: key}, To: smap.Edge{Key: key}})
+	return t.snap.Get(key)
+}
+
+//Range returns an Iterator over the keys within the interval, with the writes of the transaction
+//merged over its snapshot. The whole interval is tracked as read, even if the iteration stops early.
+func (t *Txn) Range(i smap.Interval) smap.Iterator {
+	t.reads = append(t.reads, i)
+	sources := []smap.Iterator{t.writes.RangeWithTombstones(i), t.snap.Range(i)}
+	return smap.NewMergeIterator(sources, smap.MergeOptions{})
+}
+
+//Put buffers the insertion of a value identified by a key.
+func (t *Txn) Put(key smap.Key, v smap.Value) {
+	t.writes.Put(key, v)
+}
+
+//Delete buffers the removal of a key.
+func (t *Txn) Delete(key smap.Key) {
+	t.writes.Delete(key)
+}
+
+//Commit applies the buffered writes atomically, unless they conflict with writes committed
+//since the transaction began, in which case nothing is written and ErrConflict is returned.
+//Errors writing the batch are returned as well. The transaction is over either way.
+func (t *Txn) Commit() error {
+	if t.done {
+		return ErrDone
+	}
+	t.done = true
+	defer t.snap.Release()
+	b := &smap.Batch{}
+	for it := t.writes.RangeWithTombstones(smap.Interval{}); it.Next(); {
+		if it.Tombstone() {
+			b.Delete(it.Key())
+		} else {
+			b.Put(it.Key(), it.Value())
+		}
+		t.reads = append(t.reads, smap.Interval{From: smap.Edge{Key: it.Key()}, To: smap.Edge{Key: it.Key()}})
+	}
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+	for _, i := range t.reads {
+		if t.s.writtenSince(i, t.snap.seq) {
+			return ErrConflict
+		}
+	}
+	if b.Len() > 0 {
+		_, err := t.s.apply(b)
+		return err
+	}
+	return nil
+}
+
+//Rollback drops the buffered writes and ends the transaction.
+func (t *Txn) Rollback() {
+	if !t.done {
+		t.done = true
+		t.snap.Release()
+	}
+}
+
+//writtenSince tells whether any user key within i has a version newer than seq.
+//The newest version of every key written after the oldest snapshot is kept, see obsolete(),
+//so this holds for seq pinned by a snapshot. It must be called with the lock held.
+func (s *Store) writtenSince(i smap.Interval, seq uint64) bool {
+	for key := range smap.All(s.m.Range(internalInterval(i))) {
+		if key.(InternalKey).Seq > seq {
+			return true
+		}
+	}
+	return false
+}
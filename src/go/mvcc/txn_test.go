@@ -0,0 +1,133 @@
+package mvcc
+
+import (
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/smap/concurrent"
+	"github.com/losmonos/stork/src/go/smap/redblack"
+	"sync"
+	"testing"
+)
+
+func TestTxnReadsOwnWrites(t *testing.T) {
+	s := New(redblack.New(NewFactory(nnFactory)))
+	for k := 0; k < 5; k++ {
+		s.Put(number(k), k)
+	}
+	txn := s.Begin()
+	txn.Put(number(1), 10)
+	txn.Delete(number(2))
+	txn.Put(number(7), 70)
+	s.Put(number(3), 30)
+	if v, found := txn.Get(number(2)); found {
+		t.Fatalf("Expected 2 to be deleted in the transaction, got %v", v)
+	}
+	if v, _ := txn.Get(number(3)); v != 3 {
+		t.Fatalf("Expected the transaction to read 3 from its snapshot, got %v", v)
+	}
+	if got := render(txn.Range(smap.Interval{})); got != "0:0 1:10 3:3 4:4 7:70 " {
+		t.Fatalf("Unexpected merged range %s", got)
+	}
+	if _, found := s.Get(number(7), s.Seq()); found {
+		t.Fatalf("Expected the writes to stay in the transaction until committed")
+	}
+	txn.Rollback()
+	if err := txn.Commit(); err != ErrDone {
+		t.Fatalf("Expected ErrDone, got %v", err)
+	}
+}
+
+func TestTxnRangeSeekBackward(t *testing.T) {
+	s := New(redblack.New(NewFactory(nnFactory)))
+	for k := 0; k < 5; k++ {
+		s.Put(number(k), k)
+	}
+	txn := s.Begin()
+	defer txn.Rollback()
+	txn.Put(number(1), 10)
+	txn.Delete(number(2))
+	s.Put(number(3), 30)
+	s.Delete(number(4))
+	it := txn.Range(smap.Interval{}).(smap.SeekableIterator)
+	for it.Next() {
+	}
+	if !it.Seek(number(2)) || it.Key() != number(3) || it.Value() != 3 {
+		t.Fatalf("Expected Seek(2) to skip the deleted 2 and land on 3:3 from the snapshot")
+	}
+	if !it.Seek(number(1)) || it.Key() != number(1) || it.Value() != 10 {
+		t.Fatalf("Expected Seek(1) to land on 1:10 from the transaction")
+	}
+	if got := render(it); got != "3:3 4:4 " {
+		t.Fatalf("Unexpected range after seeking %s", got)
+	}
+}
+
+func TestTxnConflicts(t *testing.T) {
+	interval := smap.Interval{From: smap.Edge{Key: number(0)}, To: smap.Edge{Key: number(10), Open: true}}
+	cases := []struct {
+		name     string
+		txn      func(txn *Txn)
+		other    func(s *Store)
+		conflict bool
+	}{
+		{"write write", func(txn *Txn) { txn.Put(number(1), 1) }, func(s *Store) { s.Put(number(1), 2) }, true},
+		{"write delete", func(txn *Txn) { txn.Put(number(1), 1) }, func(s *Store) { s.Delete(number(1)) }, true},
+		{"read write", func(txn *Txn) { txn.Get(number(5)) }, func(s *Store) { s.Put(number(5), 2) }, true},
+		{"range write", func(txn *Txn) { render(txn.Range(interval)) }, func(s *Store) { s.Put(number(9), 2) }, true},
+		{"range put delete", func(txn *Txn) { render(txn.Range(interval)) }, func(s *Store) { s.Put(number(8), 2); s.Delete(number(8)) }, true},
+		{"range outside", func(txn *Txn) { render(txn.Range(interval)) }, func(s *Store) { s.Put(number(10), 2) }, false},
+		{"disjoint writes", func(txn *Txn) { txn.Put(number(1), 1) }, func(s *Store) { s.Put(number(2), 2) }, false},
+	}
+	for _, c := range cases {
+		s := New(redblack.New(NewFactory(nnFactory)))
+		s.Put(number(1), 0)
+		txn := s.Begin()
+		c.txn(txn)
+		txn.Put(number(20), 1)
+		c.other(s)
+		err := txn.Commit()
+		if c.conflict && err != ErrConflict {
+			t.Errorf("%s: expected ErrConflict, got %v", c.name, err)
+		} else if !c.conflict && err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		}
+		if _, found := s.Get(number(20), s.Seq()); found == c.conflict {
+			t.Errorf("%s: expected the writes to be applied only without conflicts", c.name)
+		}
+	}
+}
+
+//TestSerializableIncrements runs concurrent read-modify-write transactions, retrying on conflicts.
+func TestSerializableIncrements(t *testing.T) {
+	s := New(concurrent.New(redblack.New(NewFactory(nnFactory))))
+	s.Put(number(0), 0)
+	s.Put(number(1), 0)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				for {
+					txn := s.Begin()
+					a, _ := txn.Get(number(0))
+					b, _ := txn.Get(number(1))
+					//keeps 0 and 1 equal, which write skew would break
+					txn.Put(number(0), a.(int)+1)
+					txn.Put(number(1), b.(int)+1)
+					if err := txn.Commit(); err == nil {
+						break
+					} else if err != ErrConflict {
+						t.Errorf("Unexpected error %v", err)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	a, _ := s.Get(number(0), s.Seq())
+	b, _ := s.Get(number(1), s.Seq())
+	if a != 200 || b != 200 {
+		t.Fatalf("Expected both counters to be 200, got %v and %v", a, b)
+	}
+}
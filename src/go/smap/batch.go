@@ -0,0 +1,140 @@
+package smap
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+//ErrInvalidBatch is returned when unmarshaling bytes that aren't a valid batch.
+var ErrInvalidBatch = errors.New("smap: invalid batch")
+
+//batchOp is a recorded operation, Value is nil for deletes.
+type batchOp struct {
+	key     Key
+	value   Value
+	deleted bool
+}
+
+//Batch records Put and Delete operations, to be applied all at once and in order.
+//The zero value is an empty batch ready to use.
+type Batch struct {
+	ops []batchOp
+}
+
+//Put records the insertion of a value identified by a key.
+func (b *Batch) Put(key Key, v Value) {
+	b.ops = append(b.ops, batchOp{key, v, false})
+}
+
+//Delete records the removal of a key.
+func (b *Batch) Delete(key Key) {
+	b.ops = append(b.ops, batchOp{key, nil, true})
+}
+
+//Len returns the amount of recorded operations.
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+//Reset empties the batch so it can be reused.
+func (b *Batch) Reset() {
+	b.ops = b.ops[:0]
+}
+
+//Each calls f for every operation in order, deleted telling deletes from puts.
+func (b *Batch) Each(f func(key Key, v Value, deleted bool)) {
+	for _, op := range b.ops {
+		f(op.key, op.value, op.deleted)
+	}
+}
+
+//ApplyTo performs the operations on m in order. It's up to the caller to make them atomic,
+//as maps applying batches do by holding their write lock.
+func (b *Batch) ApplyTo(m SMap) {
+	for _, op := range b.ops {
+		if op.deleted {
+			m.Delete(op.key)
+		} else {
+			m.Put(op.key, op.value)
+		}
+	}
+}
+
+//Marshal encodes the batch as the uvarint amount of operations followed by the operations,
+//each one being its kind byte (1 for put, 2 for delete), the uvarint length of the encoded key,
+//the key and, for puts, the uvarint length of the encoded value and the value.
+func (b *Batch) Marshal(c Codec) ([]byte, error) {
+	buf := binary.AppendUvarint(nil, uint64(len(b.ops)))
+	for _, op := range b.ops {
+		key, err := c.EncodeKey(op.key)
+		if err != nil {
+			return nil, err
+		}
+		if op.deleted {
+			buf = append(buf, 2)
+		} else {
+			buf = append(buf, 1)
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(key)))
+		buf = append(buf, key...)
+		if op.deleted {
+			continue
+		}
+		value, err := c.EncodeValue(op.value)
+		if err != nil {
+			return nil, err
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(value)))
+		buf = append(buf, value...)
+	}
+	return buf, nil
+}
+
+//UnmarshalBatch decodes a batch encoded by Marshal.
+func UnmarshalBatch(data []byte, c Codec) (*Batch, error) {
+	count, n := binary.Uvarint(data)
+	//every operation takes at least two bytes
+	if n <= 0 || count > uint64(len(data)-n)/2 {
+		return nil, ErrInvalidBatch
+	}
+	data = data[n:]
+	b := &Batch{ops: make([]batchOp, 0, count)}
+	//field cuts a uvarint length prefixed field off data
+	field := func() ([]byte, error) {
+		length, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < length {
+			return nil, ErrInvalidBatch
+		}
+		f := data[n : n+int(length)]
+		data = data[n+int(length):]
+		return f, nil
+	}
+	for i := uint64(0); i < count; i++ {
+		if len(data) == 0 || data[0] < 1 || data[0] > 2 {
+			return nil, ErrInvalidBatch
+		}
+		op := batchOp{deleted: data[0] == 2}
+		data = data[1:]
+		key, err := field()
+		if err != nil {
+			return nil, err
+		}
+		if op.key, err = c.DecodeKey(key); err != nil {
+			return nil, err
+		}
+		if !op.deleted {
+			value, err := field()
+			if err != nil {
+				return nil, err
+			}
+			if op.value, err = c.DecodeValue(value); err != nil {
+				return nil, err
+			}
+		}
+		b.ops = append(b.ops, op)
+	}
+	if len(data) != 0 {
+		return nil, ErrInvalidBatch
+	}
+	return b, nil
+}
@@ -0,0 +1,72 @@
+package smap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+//numberCodec encodes number keys as varints and string values as their bytes.
+type numberCodec struct{}
+
+func (numberCodec) EncodeKey(k Key) ([]byte, error) {
+	return binary.AppendVarint(nil, int64(k.(number))), nil
+}
+
+func (numberCodec) DecodeKey(b []byte) (Key, error) {
+	n, _ := binary.Varint(b)
+	return number(n), nil
+}
+
+func (numberCodec) EncodeValue(v Value) ([]byte, error) { return []byte(v.(string)), nil }
+
+func (numberCodec) DecodeValue(b []byte) (Value, error) { return string(b), nil }
+
+//recorder is an SMap that just records the Puts and Deletes it gets.
+type recorder struct {
+	SMap
+	ops string
+}
+
+func (r *recorder) Put(key Key, v Value) { r.ops += fmt.Sprintf("put %v %v,", key, v) }
+
+func (r *recorder) Delete(key Key) (Value, bool) {
+	r.ops += fmt.Sprintf("delete %v,", key)
+	return nil, false
+}
+
+func TestBatchRoundTrip(t *testing.T) {
+	b := &Batch{}
+	b.Put(number(1), "one")
+	b.Delete(number(-2))
+	b.Put(number(300), "")
+	b.Put(number(1), "uno")
+	data, err := b.Marshal(numberCodec{})
+	if err != nil {
+		t.Fatalf("Unexpected error marshaling: %s", err)
+	}
+	decoded, err := UnmarshalBatch(data, numberCodec{})
+	if err != nil {
+		t.Fatalf("Unexpected error unmarshaling: %s", err)
+	}
+	expected := "put 1 one,delete -2,put 300 ,put 1 uno,"
+	for _, batch := range []*Batch{b, decoded} {
+		r := &recorder{}
+		batch.ApplyTo(r)
+		if r.ops != expected {
+			t.Errorf("Expected %s, got %s", expected, r.ops)
+		}
+	}
+	for cut := 0; cut < len(data); cut++ {
+		if _, err := UnmarshalBatch(data[:cut], numberCodec{}); err != ErrInvalidBatch {
+			t.Errorf("Expected ErrInvalidBatch for %d bytes, got %v", cut, err)
+		}
+	}
+	if _, err := UnmarshalBatch(append(data, 0), numberCodec{}); err != ErrInvalidBatch {
+		t.Errorf("Expected ErrInvalidBatch for trailing bytes, got %v", err)
+	}
+	b.Reset()
+	if data, _ := b.Marshal(numberCodec{}); b.Len() != 0 || len(data) != 1 {
+		t.Errorf("Expected an empty batch, got %d operations in %d bytes", b.Len(), len(data))
+	}
+}
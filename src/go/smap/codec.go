@@ -0,0 +1,37 @@
+package smap
+
+//Codec translates Keys and Values to and from bytes, so they can be persisted or sent over the wire.
+//Encodings must be deterministic: keys that compare equal should encode to the same bytes.
+type Codec interface {
+	KeyCodec
+	ValueCodec
+}
+
+//KeyCodec translates Keys to and from bytes.
+type KeyCodec interface {
+	EncodeKey(k Key) ([]byte, error)
+	DecodeKey(b []byte) (Key, error)
+}
+
+//ValueCodec translates Values to and from bytes.
+type ValueCodec interface {
+	EncodeValue(v Value) ([]byte, error)
+	DecodeValue(b []byte) (Value, error)
+}
+
+//NewCodec builds a Codec out of a KeyCodec and a ValueCodec.
+func NewCodec(keys KeyCodec, values ValueCodec) Codec {
+	return struct {
+		KeyCodec
+		ValueCodec
+	}{keys, values}
+}
+
+//EncodableKey is a Key that knows its own order preserving binary encoding:
+//comparing the encodings of two keys with bytes.Compare gives the same result as Cmp.
+//UnmarshalKey decodes a key of the same type as the receiver, which is used just as a prototype.
+type EncodableKey interface {
+	Key
+	MarshalKey() []byte
+	UnmarshalKey(b []byte) (Key, error)
+}
@@ -0,0 +1,173 @@
+package concurrent
+
+import (
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/smap/redblack"
+	"sync"
+)
+
+//Map wraps an SMap so it can be used from several goroutines.
+//version counts the writes, so fail fast iterators can tell the map changed under them.
+//snapshot, if set, is the latest snapshot of a persistent RedBlack, shared by the iterators
+//until the next write. snapshotMu guards it among readers.
+type Map struct {
+	mu         sync.RWMutex
+	m          smap.SMap
+	version    uint64
+	persistent *redblack.RedBlack
+	snapshotMu sync.Mutex
+	snapshot   *redblack.Snapshot
+}
+
+//New wraps m, which must not be used directly from then on. Its iterators fail fast.
+func New(m smap.SMap) *Map {
+	return &Map{m: m}
+}
+
+//NewWithSnapshots wraps a persistent RedBlack, see redblack.NewPersistent.
+//Its iterators read snapshots, so they are never invalidated by writes.
+func NewWithSnapshots(m *redblack.RedBlack) *Map {
+	return &Map{m: m, persistent: m}
+}
+
+//Get searches for a given key and returns it's associated value
+//and a boolean indicating if it was found.
+func (c *Map) Get(key smap.Key) (v smap.Value, found bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.m.Get(key)
+}
+
+//Put inserts a value identified by a key.
+func (c *Map) Put(key smap.Key, v smap.Value) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m.Put(key, v)
+	c.modified()
+}
+
+//Delete removes a key and returns the value it held and a boolean indicating if it was found.
+func (c *Map) Delete(key smap.Key) (v smap.Value, found bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, found = c.m.Delete(key)
+	c.modified()
+	return v, found
+}
+
+//Apply performs all the operations of a batch holding the write lock, so readers see all of them or none.
+//It never fails, the error is returned to match stork DBs.
+func (c *Map) Apply(b *smap.Batch) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b.ApplyTo(c.m)
+	c.modified()
+	return nil
+}
+
+//modified invalidates the fail fast iterators and the latest snapshot.
+//It must be called with the write lock held.
+func (c *Map) modified() {
+	c.version++
+	c.snapshot = nil
+}
+
+//Range returns an Iterator over the entries within the interval, in order.
+func (c *Map) Range(i smap.Interval) smap.Iterator {
+	return c.scan(i, false)
+}
+
+//RangeReverse returns an Iterator over the entries within the interval, in reverse order.
+func (c *Map) RangeReverse(i smap.Interval) smap.Iterator {
+	return c.scan(i, true)
+}
+
+//scan returns an iterator over a snapshot if there's one to take, or a fail fast iterator.
+func (c *Map) scan(i smap.Interval, reverse bool) smap.Iterator {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var source smap.SMapReader = c.m
+	if c.persistent != nil {
+		source = c.latestSnapshot()
+	}
+	var it smap.Iterator
+	if reverse {
+		it = source.RangeReverse(i)
+	} else {
+		it = source.Range(i)
+	}
+	if c.persistent != nil {
+		return it
+	}
+	return &Iterator{c: c, it: it, version: c.version}
+}
+
+//latestSnapshot returns a snapshot of the current contents, taking one only if there were writes
+//since the last one. It must be called with the read lock held.
+func (c *Map) latestSnapshot() *redblack.Snapshot {
+	c.snapshotMu.Lock()
+	defer c.snapshotMu.Unlock()
+	if c.snapshot == nil {
+		c.snapshot = c.persistent.Snapshot()
+	}
+	return c.snapshot
+}
+
+//Floor returns the greatest key <= key, along with its value.
+func (c *Map) Floor(key smap.Key) (k smap.Key, v smap.Value, found bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.m.Floor(key)
+}
+
+//Ceiling returns the least key >= key, along with its value.
+func (c *Map) Ceiling(key smap.Key) (k smap.Key, v smap.Value, found bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.m.Ceiling(key)
+}
+
+//Lower returns the greatest key < key, along with its value.
+func (c *Map) Lower(key smap.Key) (k smap.Key, v smap.Value, found bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.m.Lower(key)
+}
+
+//Higher returns the least key > key, along with its value.
+func (c *Map) Higher(key smap.Key) (k smap.Key, v smap.Value, found bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.m.Higher(key)
+}
+
+//Min returns the least key, along with its value.
+func (c *Map) Min() (k smap.Key, v smap.Value, found bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.m.Min()
+}
+
+//Max returns the greatest key, along with its value.
+func (c *Map) Max() (k smap.Key, v smap.Value, found bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.m.Max()
+}
+
+//Len returns the amount of keys in the map.
+func (c *Map) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.m.Len()
+}
+
+//Size returns the size of the map contents.
+func (c *Map) Size() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.m.Size()
+}
+
+//enforce Map implements SMap
+var _ smap.SMap = &Map{}
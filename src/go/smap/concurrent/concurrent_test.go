@@ -0,0 +1,212 @@
+package concurrent
+
+import (
+	"fmt"
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/smap/redblack"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+//loaded returns both kinds of Map holding the keys in [0, n) mapped to themselves.
+func loaded(n int) []*Map {
+	maps := []*Map{New(redblack.New(nnFactory)), NewWithSnapshots(redblack.NewPersistent(nnFactory))}
+	for _, m := range maps {
+		for k := 0; k < n; k++ {
+			m.Put(number(k), k)
+		}
+	}
+	return maps
+}
+
+func TestMatchesRedBlack(t *testing.T) {
+	for _, m := range loaded(0) {
+		model := redblack.New(nnFactory)
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 2000; i++ {
+			k := number(r.Intn(300))
+			if r.Intn(3) == 0 {
+				if got, expected := fmt.Sprint(m.Delete(k)), fmt.Sprint(model.Delete(k)); got != expected {
+					t.Fatalf("Expected Delete(%d) to return %s, got %s", k, expected, got)
+				}
+			} else {
+				m.Put(k, i)
+				model.Put(k, i)
+			}
+		}
+		if m.Len() != model.Len() || m.Size() != model.Size() {
+			t.Fatalf("Expected %d keys and %d bytes, got %d and %d", model.Len(), model.Size(), m.Len(), m.Size())
+		}
+		for k := -1; k <= 300; k++ {
+			key := number(k)
+			for _, pair := range [][2]string{
+				{fmt.Sprint(model.Get(key)), fmt.Sprint(m.Get(key))},
+				{fmt.Sprint(model.Floor(key)), fmt.Sprint(m.Floor(key))},
+				{fmt.Sprint(model.Ceiling(key)), fmt.Sprint(m.Ceiling(key))},
+				{fmt.Sprint(model.Lower(key)), fmt.Sprint(m.Lower(key))},
+				{fmt.Sprint(model.Higher(key)), fmt.Sprint(m.Higher(key))},
+			} {
+				if pair[0] != pair[1] {
+					t.Fatalf("Mismatch on %d: expected %s, got %s", k, pair[0], pair[1])
+				}
+			}
+		}
+		if fmt.Sprint(model.Min()) != fmt.Sprint(m.Min()) || fmt.Sprint(model.Max()) != fmt.Sprint(m.Max()) {
+			t.Fatalf("Min or Max mismatch")
+		}
+		i := smap.Interval{From: smap.Edge{Key: number(50)}, To: smap.Edge{Key: number(250), Open: true}}
+		for _, reverse := range []bool{false, true} {
+			expected, got := model.Range(i), m.Range(i)
+			if reverse {
+				expected, got = model.RangeReverse(i), m.RangeReverse(i)
+			}
+			for expected.Next() {
+				if !got.Next() || got.Key() != expected.Key() || got.Value() != expected.Value() {
+					t.Fatalf("Expected %v in the scan", expected.Key())
+				}
+			}
+			if got.Next() {
+				t.Fatalf("Unexpected %v at the end of the scan", got.Key())
+			}
+		}
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	m := loaded(10)[0]
+	it := m.Range(smap.Interval{}).(*Iterator)
+	if !it.Next() || !it.Next() || it.Key() != number(1) {
+		t.Fatalf("Expected to iterate before writing")
+	}
+	m.Put(number(20), 20)
+	if it.Next() {
+		t.Fatalf("Expected the iterator to stop after a write, got %v", it.Key())
+	}
+	if it.Err() != ErrModified {
+		t.Fatalf("Expected ErrModified, got %v", it.Err())
+	}
+	if it.Next() || it.Seek(number(5)) {
+		t.Fatalf("Expected a failed iterator to stay stopped")
+	}
+	it.Close()
+
+	it = m.Range(smap.Interval{}).(*Iterator)
+	if !it.Seek(number(5)) || it.Key() != number(5) || it.Err() != nil {
+		t.Fatalf("Expected Seek to find 5, got %v, %v", it.Key(), it.Err())
+	}
+}
+
+func TestSnapshotIterator(t *testing.T) {
+	m := loaded(10)[1]
+	it := m.Range(smap.Interval{})
+	before := m.Range(smap.Interval{})
+	for k := 0; k < 10; k++ {
+		m.Delete(number(k))
+		m.Put(number(k+100), k)
+	}
+	for _, it := range []smap.Iterator{it, before} {
+		k := 0
+		for ; it.Next(); k++ {
+			if it.Key() != number(k) {
+				t.Fatalf("Expected %d from the snapshot, got %v", k, it.Key())
+			}
+		}
+		if k != 10 {
+			t.Fatalf("Expected 10 keys from the snapshot, got %d", k)
+		}
+	}
+	if k, _, _ := m.Min(); k != number(100) {
+		t.Fatalf("Expected the map to start at 100, got %v", k)
+	}
+}
+
+//TestConcurrentReadersAndWriters is meant to be run with the race detector.
+func TestConcurrentReadersAndWriters(t *testing.T) {
+	for _, m := range loaded(500) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 100)
+		for w := 0; w < 2; w++ {
+			wg.Add(1)
+			go func(seed int64) {
+				defer wg.Done()
+				r := rand.New(rand.NewSource(seed))
+				for i := 0; i < 2000; i++ {
+					k := number(r.Intn(1000))
+					if r.Intn(2) == 0 {
+						m.Delete(k)
+					} else {
+						m.Put(k, int(k))
+					}
+				}
+			}(int64(w))
+		}
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					previous := -1
+					it := m.Range(smap.Interval{})
+					for it.Next() {
+						k := int(it.Key().(number))
+						if k <= previous || it.Value() != k {
+							errs <- fmt.Errorf("Unexpected %d after %d", k, previous)
+							return
+						}
+						previous = k
+					}
+					if failFast, ok := it.(*Iterator); ok && failFast.Err() != nil && failFast.Err() != ErrModified {
+						errs <- failFast.Err()
+						return
+					}
+					m.Get(number(i))
+					m.Floor(number(i))
+					m.Len()
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestApplyIsAtomic(t *testing.T) {
+	for _, m := range loaded(0) {
+		b := &smap.Batch{}
+		for k := 0; k < 10; k++ {
+			b.Put(number(k), 0)
+		}
+		m.Apply(b)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b := &smap.Batch{}
+			for i := 1; i < 200; i++ {
+				b.Reset()
+				for k := 0; k < 10; k++ {
+					b.Put(number(k), i)
+				}
+				m.Apply(b)
+			}
+		}()
+		for i := 0; i < 200; i++ {
+			values := map[smap.Value]int{}
+			it := m.Range(smap.Interval{})
+			for it.Next() {
+				values[it.Value()]++
+			}
+			if failFast, ok := it.(*Iterator); ok && failFast.Err() != nil {
+				continue
+			}
+			if len(values) != 1 {
+				t.Fatalf("Expected every key to come from the same batch, got %v", values)
+			}
+		}
+		wg.Wait()
+	}
+}
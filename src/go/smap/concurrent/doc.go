@@ -0,0 +1,8 @@
+//Goroutine safe wrapper of a sorted map.
+//Writers are serialized and readers run in parallel, as with a sync.RWMutex.
+//
+//Iterators never walk a map while it is being written. A Map built with NewWithSnapshots
+//iterates over a snapshot of a persistent RedBlack, so its iterators see the contents as they
+//were when Range was called, regardless of later writes. Otherwise iterators fail fast:
+//they stop as soon as the map is modified, and their Err() returns ErrModified.
+package concurrent
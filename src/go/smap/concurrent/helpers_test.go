@@ -0,0 +1,10 @@
+//Helpers for testing concurrent Maps with int Keys, see fixtures.
+package concurrent
+
+import (
+	"github.com/losmonos/stork/src/go/internal/fixtures"
+)
+
+type number = fixtures.Number
+
+var nnFactory = fixtures.NNFactory
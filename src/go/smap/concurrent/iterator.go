@@ -0,0 +1,79 @@
+package concurrent
+
+import (
+	"errors"
+	"github.com/losmonos/stork/src/go/smap"
+	"io"
+)
+
+//ErrModified is reported by fail fast iterators whose map was modified while iterating.
+var ErrModified = errors.New("concurrent: map modified during iteration")
+
+//Iterator is a fail fast iterator: it advances the wrapped iterator holding the read lock,
+//as long as there were no writes since it was created. After a write it stops and Err() returns ErrModified.
+//The current key and value are copied out of the wrapped iterator, so they stay valid after a write.
+type Iterator struct {
+	c       *Map
+	it      smap.Iterator
+	version uint64
+	key     smap.Key
+	value   smap.Value
+	err     error
+}
+
+//Next advances the iterator one step and if returns true, an entry will be available upon calling Key() and Value()
+func (i *Iterator) Next() bool {
+	return i.step(func() bool { return i.it.Next() })
+}
+
+//Seek moves the iterator to the first entry which key is >= key (<= key on reverse iterators).
+//It panics if the wrapped iterator doesn't implement smap.SeekableIterator.
+func (i *Iterator) Seek(key smap.Key) bool {
+	seekable := i.it.(smap.SeekableIterator)
+	return i.step(func() bool { return seekable.Seek(key) })
+}
+
+//step moves the wrapped iterator with move, unless the map was modified.
+func (i *Iterator) step(move func() bool) bool {
+	if i.err != nil {
+		return false
+	}
+	i.c.mu.RLock()
+	defer i.c.mu.RUnlock()
+	if i.c.version != i.version {
+		i.err = ErrModified
+		i.key, i.value = nil, nil
+		return false
+	}
+	if !move() {
+		return false
+	}
+	i.key, i.value = i.it.Key(), i.it.Value()
+	return true
+}
+
+//Key returns the current key in the iterator.
+func (i *Iterator) Key() smap.Key {
+	return i.key
+}
+
+//Value returns the current value in the iterator.
+func (i *Iterator) Value() smap.Value {
+	return i.value
+}
+
+//Err returns ErrModified if the iterator stopped because the map was modified, nil otherwise.
+func (i *Iterator) Err() error {
+	return i.err
+}
+
+//Close closes the wrapped iterator if it implements io.Closer.
+func (i *Iterator) Close() error {
+	if closer, ok := i.it.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+//enforce Iterator implements SeekableIterator
+var _ smap.SeekableIterator = &Iterator{}
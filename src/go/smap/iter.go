@@ -0,0 +1,37 @@
+package smap
+
+import (
+	"io"
+	"iter"
+)
+
+//All adapts an Iterator to a range-over-func sequence, so it can be used as in
+//
+//	for k, v := range smap.All(m.Range(i)) {
+//
+//The sequence consumes the iterator, so it can only be ranged over once.
+//If the iterator implements io.Closer it is closed once the loop ends, early break included.
+func All(it Iterator) iter.Seq2[Key, Value] {
+	return func(yield func(Key, Value) bool) {
+		if closer, ok := it.(io.Closer); ok {
+			defer closer.Close()
+		}
+		for it.Next() {
+			if !yield(it.Key(), it.Value()) {
+				return
+			}
+		}
+	}
+}
+
+//First returns the first entry of an iterator, closing it if it implements io.Closer.
+//It helps implementing Floor, Ceiling and the like on top of Range and RangeReverse.
+func First(it Iterator) (k Key, v Value, found bool) {
+	if closer, ok := it.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if it.Next() {
+		return it.Key(), it.Value(), true
+	}
+	return nil, nil, false
+}
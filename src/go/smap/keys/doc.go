@@ -0,0 +1,12 @@
+//Built-in encodable keys and a registry of key codecs.
+//Every key type in this package implements smap.EncodableKey, so its binary encoding
+//sorts, byte by byte, the same way as its Cmp: encoded keys can be stored in tables,
+//hashed, or compared without being decoded.
+//
+//Tuple composes keys, the elements at the same position being of the same type.
+//Desc reverses the order of an element, and Max sorts after any element, so
+//a Tuple followed by Max bounds the range of keys starting with it.
+//
+//Codecs are registered by name, so the key type of persisted data can be recorded
+//along with it. Composite keys are named after their elements, as in "tuple(string,desc(int))".
+package keys
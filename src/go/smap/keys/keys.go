@@ -0,0 +1,208 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/losmonos/stork/src/go/smap"
+	"math"
+	"strings"
+)
+
+//ErrInvalid is returned when decoding bytes that aren't a valid key encoding.
+var ErrInvalid = errors.New("keys: invalid encoding")
+
+//String is a string key, encoded as its bytes.
+type String string
+
+//Cmp compares two String Keys
+func (s String) Cmp(other smap.Key) int {
+	return strings.Compare(string(s), string(other.(String)))
+}
+
+func (s String) MarshalKey() []byte { return []byte(s) }
+
+func (String) UnmarshalKey(b []byte) (smap.Key, error) { return String(b), nil }
+
+//IsPrefixOf tells whether k starts with s.
+func (s String) IsPrefixOf(k smap.Key) bool {
+	return strings.HasPrefix(string(k.(String)), string(s))
+}
+
+//PrefixEnd returns the smallest String greater than all the ones starting with s:
+//s with its trailing 0xff bytes dropped and its last byte incremented.
+//It returns nil if s is empty or made of 0xff bytes.
+func (s String) PrefixEnd() smap.Key {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] != 0xff {
+			return s[:i] + String([]byte{s[i] + 1})
+		}
+	}
+	return nil
+}
+
+//Bytes is a byte string key, encoded as itself.
+type Bytes []byte
+
+//Cmp compares two Bytes Keys
+func (b Bytes) Cmp(other smap.Key) int {
+	return bytes.Compare(b, other.(Bytes))
+}
+
+func (b Bytes) MarshalKey() []byte { return append([]byte{}, b...) }
+
+func (Bytes) UnmarshalKey(b []byte) (smap.Key, error) { return Bytes(append([]byte{}, b...)), nil }
+
+//IsPrefixOf tells whether k starts with b.
+func (b Bytes) IsPrefixOf(k smap.Key) bool {
+	return bytes.HasPrefix(k.(Bytes), b)
+}
+
+//PrefixEnd returns the smallest Bytes greater than all the ones starting with b:
+//b with its trailing 0xff bytes dropped and its last byte incremented.
+//It returns nil if b is empty or made of 0xff bytes.
+func (b Bytes) PrefixEnd() smap.Key {
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] != 0xff {
+			end := append(Bytes{}, b[:i+1]...)
+			end[i]++
+			return end
+		}
+	}
+	return nil
+}
+
+//Bool is a boolean key, encoded as a 0 or 1 byte: false sorts first.
+type Bool bool
+
+//Cmp compares two Bool Keys
+func (b Bool) Cmp(other smap.Key) int {
+	if b == other.(Bool) {
+		return 0
+	} else if b {
+		return 1
+	}
+	return -1
+}
+
+func (b Bool) MarshalKey() []byte {
+	if b {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+func (Bool) UnmarshalKey(b []byte) (smap.Key, error) {
+	if len(b) != 1 || b[0] > 1 {
+		return nil, ErrInvalid
+	}
+	return Bool(b[0] == 1), nil
+}
+
+//Int is a signed integer key, encoded big endian with the sign bit flipped.
+type Int int64
+
+//Cmp compares two Int Keys
+func (i Int) Cmp(other smap.Key) int {
+	o := other.(Int)
+	if i < o {
+		return -1
+	} else if i > o {
+		return 1
+	}
+	return 0
+}
+
+func (i Int) MarshalKey() []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(i)^1<<63)
+}
+
+func (Int) UnmarshalKey(b []byte) (smap.Key, error) {
+	if len(b) != 8 {
+		return nil, ErrInvalid
+	}
+	return Int(binary.BigEndian.Uint64(b) ^ 1<<63), nil
+}
+
+//Uint is an unsigned integer key, encoded big endian.
+type Uint uint64
+
+//Cmp compares two Uint Keys
+func (u Uint) Cmp(other smap.Key) int {
+	o := other.(Uint)
+	if u < o {
+		return -1
+	} else if u > o {
+		return 1
+	}
+	return 0
+}
+
+func (u Uint) MarshalKey() []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(u))
+}
+
+func (Uint) UnmarshalKey(b []byte) (smap.Key, error) {
+	if len(b) != 8 {
+		return nil, ErrInvalid
+	}
+	return Uint(binary.BigEndian.Uint64(b)), nil
+}
+
+//Float is a floating point key. Negative numbers have all their bits flipped
+//and positive ones just the sign bit, so the encoding sorts big endian.
+//Cmp follows the encoding, which makes it a total order: -0 sorts before +0,
+//and NaNs sort before -Inf or after +Inf depending on their sign bit.
+type Float float64
+
+//Cmp compares two Float Keys
+func (f Float) Cmp(other smap.Key) int {
+	a, b := f.bits(), other.(Float).bits()
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+//bits returns the order preserving transformation of the float bits.
+func (f Float) bits() uint64 {
+	b := math.Float64bits(float64(f))
+	if b&(1<<63) != 0 {
+		return ^b
+	}
+	return b | 1<<63
+}
+
+func (f Float) MarshalKey() []byte {
+	return binary.BigEndian.AppendUint64(nil, f.bits())
+}
+
+func (Float) UnmarshalKey(b []byte) (smap.Key, error) {
+	if len(b) != 8 {
+		return nil, ErrInvalid
+	}
+	bits := binary.BigEndian.Uint64(b)
+	if bits&(1<<63) != 0 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return Float(math.Float64frombits(bits)), nil
+}
+
+//enforce the built-in keys implement EncodableKey
+var (
+	_ smap.EncodableKey = String("")
+	_ smap.EncodableKey = Bytes{}
+	_ smap.EncodableKey = Bool(false)
+	_ smap.EncodableKey = Int(0)
+	_ smap.EncodableKey = Uint(0)
+	_ smap.EncodableKey = Float(0)
+	_ smap.EncodableKey = Tuple{}
+	_ smap.EncodableKey = Desc{}
+	_ smap.PrefixKey    = String("")
+	_ smap.PrefixKey    = Bytes{}
+	_ smap.PrefixKey    = Tuple{}
+)
@@ -0,0 +1,326 @@
+package keys
+
+import (
+	"bytes"
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/smap/redblack"
+	"math"
+	"testing"
+	"testing/quick"
+)
+
+//sign reduces a comparison to -1, 0 or 1.
+func sign(cmp int) int {
+	if cmp < 0 {
+		return -1
+	} else if cmp > 0 {
+		return 1
+	}
+	return 0
+}
+
+//checkOrder verifies that a and b encodings sort like a.Cmp(b) and that they roundtrip.
+func checkOrder(t *testing.T, a, b smap.EncodableKey) bool {
+	ea, eb := a.MarshalKey(), b.MarshalKey()
+	if bytes.Compare(ea, eb) != sign(a.Cmp(b)) {
+		t.Errorf("Encodings of %v and %v don't sort like Cmp", a, b)
+		return false
+	}
+	decoded, err := a.UnmarshalKey(ea)
+	if err != nil || decoded.Cmp(a) != 0 {
+		t.Errorf("Expected %v to roundtrip, got %v, %v", a, decoded, err)
+		return false
+	}
+	return true
+}
+
+func TestOrderPreserved(t *testing.T) {
+	checks := []interface{}{
+		func(a, b string) bool { return checkOrder(t, String(a), String(b)) },
+		func(a, b int64) bool { return checkOrder(t, Int(a), Int(b)) },
+		func(a, b uint64) bool { return checkOrder(t, Uint(a), Uint(b)) },
+		func(a, b float64) bool { return checkOrder(t, Float(a), Float(b)) },
+		func(a1, b1 string, a2, b2 int64) bool {
+			return checkOrder(t, Tuple{String(a1), Int(a2)}, Tuple{String(b1), Int(b2)})
+		},
+	}
+	for _, check := range checks {
+		if err := quick.Check(check, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFloatOrder(t *testing.T) {
+	floats := []float64{math.Inf(-1), -1e300, -1, -1e-300, 0, 1e-300, 1, 1e300, math.Inf(1)}
+	for i := 1; i < len(floats); i++ {
+		if Float(floats[i-1]).Cmp(Float(floats[i])) >= 0 || !checkOrder(t, Float(floats[i-1]), Float(floats[i])) {
+			t.Fatalf("Expected %v < %v", floats[i-1], floats[i])
+		}
+	}
+}
+
+func TestTupleEdgeCases(t *testing.T) {
+	tuples := []Tuple{
+		{},
+		{String("")},
+		{String(""), Int(-1)},
+		{String("\x00")},
+		{String("\x00\x00")},
+		{String("\x00\x01")},
+		{String("a")},
+		{String("a"), Int(math.MinInt64)},
+		{String("a"), Int(0)},
+		{String("a\x00")},
+		{String("ab")},
+	}
+	for i := 1; i < len(tuples); i++ {
+		if tuples[i-1].Cmp(tuples[i]) >= 0 || !checkOrder(t, tuples[i-1], tuples[i]) {
+			t.Fatalf("Expected %q < %q", tuples[i-1], tuples[i])
+		}
+	}
+	proto := Tuple{String(""), Int(0)}
+	for _, b := range [][]byte{{0x00}, {'a', 0x00, 0x02}, {'a'}, Tuple{String("a"), Int(1), Int(2)}.MarshalKey()} {
+		if k, err := proto.UnmarshalKey(b); err == nil {
+			t.Fatalf("Expected %q to be invalid, got %v", b, k)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	c, err := Lookup("tuple(string, tuple(int,float))")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	key := Tuple{String("lemon"), Tuple{Int(-3), Float(0.5)}}
+	b, err := c.EncodeKey(key)
+	if err != nil {
+		t.Fatalf("Unexpected error encoding: %s", err)
+	}
+	if decoded, err := c.DecodeKey(b); err != nil || decoded.Cmp(key) != 0 {
+		t.Fatalf("Expected %v, got %v, %v", key, decoded, err)
+	}
+	c, err = Lookup("tuple(bytes,desc(int),bool)")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	key = Tuple{Bytes("lemon"), Desc{Int(-3)}, Bool(true)}
+	if b, err = c.EncodeKey(key); err != nil {
+		t.Fatalf("Unexpected error encoding: %s", err)
+	}
+	if decoded, err := c.DecodeKey(b); err != nil || decoded.Cmp(key) != 0 {
+		t.Fatalf("Expected %v, got %v, %v", key, decoded, err)
+	}
+	for _, name := range []string{"complex", "tuple(", "tuple()", "tuple(int,(string)", "tuple(int,complex)", "desc()"} {
+		if _, err := Lookup(name); err == nil {
+			t.Fatalf("Expected %q not to be found", name)
+		}
+	}
+	//the registry is global, the test may run more than once
+	if _, err := Lookup("reverse"); err != nil {
+		Register("reverse", reverseCodec{})
+	}
+	if c, err := Lookup("tuple(reverse)"); err != nil || c.(tupleCodec)[0] != (reverseCodec{}) {
+		t.Fatalf("Expected the registered codec to be found, got %v, %v", c, err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("Expected registering a name twice to panic")
+		}
+	}()
+	Register("string", reverseCodec{})
+}
+
+//reverseCodec encodes Uint keys in descending order.
+type reverseCodec struct{}
+
+func (reverseCodec) EncodeKey(k smap.Key) ([]byte, error) { return Uint(^k.(Uint)).MarshalKey(), nil }
+
+func (reverseCodec) DecodeKey(b []byte) (smap.Key, error) {
+	k, err := Uint(0).UnmarshalKey(b)
+	if err != nil {
+		return nil, err
+	}
+	return ^k.(Uint), nil
+}
+
+func TestStringPrefixEnd(t *testing.T) {
+	cases := map[String]smap.Key{"": nil, "\xff\xff": nil, "ab": String("ac"), "a\xff": String("b"), "a\xff\xff": String("b"),
+		"\x7f": String("\x80"), "a\xfe\xff": String("a\xff"), "é": String("\xc3\xaa")}
+	for prefix, expected := range cases {
+		if end := prefix.PrefixEnd(); end != expected {
+			t.Fatalf("Expected the end of %q to be %q, got %q", prefix, expected, end)
+		}
+	}
+	if !String("ab").IsPrefixOf(String("abc")) || String("abc").IsPrefixOf(String("ab")) {
+		t.Fatalf("Unexpected IsPrefixOf")
+	}
+}
+
+func TestBytesPrefixEnd(t *testing.T) {
+	cases := map[string]smap.Key{"": nil, "\xff\xff": nil, "ab": Bytes("ac"), "a\xff": Bytes("b"), "a\xff\xff": Bytes("b"),
+		"\x7f": Bytes("\x80"), "a\xfe\xff": Bytes("a\xff"), "é": Bytes("\xc3\xaa")}
+	for prefix, expected := range cases {
+		end := Bytes(prefix).PrefixEnd()
+		if (end == nil) != (expected == nil) || (end != nil && !bytes.Equal(end.(Bytes), expected.(Bytes))) {
+			t.Fatalf("Expected the end of %q to be %q, got %q", prefix, expected, end)
+		}
+	}
+	prefix := Bytes("a\xff")
+	if prefix.PrefixEnd(); !bytes.Equal(prefix, Bytes("a\xff")) {
+		t.Fatalf("Expected PrefixEnd to leave the prefix untouched, got %q", prefix)
+	}
+	if !Bytes("ab").IsPrefixOf(Bytes("abc")) || Bytes("abc").IsPrefixOf(Bytes("ab")) {
+		t.Fatalf("Unexpected IsPrefixOf")
+	}
+}
+
+func TestPrefixInterval(t *testing.T) {
+	keys := []string{"", "a", "\x7f", "\x7f\x00", "\x7f\xff", "\x80", "\xc2\x80", "é", "éa", "ê", "\xff", "\xff\xff"}
+	for _, prefix := range keys {
+		ofString, ofBytes := smap.PrefixInterval(String(prefix)), smap.PrefixInterval(Bytes(prefix))
+		for _, k := range keys {
+			expected := len(k) >= len(prefix) && k[:len(prefix)] == prefix
+			if ofString.Contains(String(k)) != expected || ofBytes.Contains(Bytes(k)) != expected {
+				t.Fatalf("Expected %q within the interval of %q to be %v", k, prefix, expected)
+			}
+		}
+	}
+}
+
+//sorted lists tuples in ascending order, with the same element types at each position.
+var sorted = []Tuple{
+	{},
+	{Bytes{}},
+	{Bytes{0x00}},
+	{Bytes{0x00}, Desc{Int(1)}},
+	{Bytes{0x00}, Desc{Int(0)}},
+	{Bytes{0x00}, Max},
+	{Bytes{0x00, 0x00}},
+	{Bytes{0x01}},
+	{Bytes("acme")},
+	{Bytes("acme"), Desc{Int(10)}},
+	{Bytes("acme"), Desc{Int(-1)}},
+	{Bytes("acme"), Desc{Int(-1)}, Bool(false)},
+	{Bytes("acme"), Desc{Int(-1)}, Bool(true)},
+	{Bytes("acme"), Desc{Int(-1)}, Max},
+	{Bytes("acme"), Desc{Int(math.MinInt64)}},
+	{Bytes("acme"), Max},
+	{Bytes("acme\x00")},
+	{Bytes("acmf")},
+	{Max},
+}
+
+//hasMax tells whether a Tuple holds Max, which can't be encoded.
+func hasMax(t Tuple) bool {
+	for _, e := range t {
+		if e == Max {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTupleOrder(t *testing.T) {
+	for i := 1; i < len(sorted); i++ {
+		a, b := sorted[i-1], sorted[i]
+		if a.Cmp(b) >= 0 || b.Cmp(a) <= 0 {
+			t.Fatalf("Expected %v < %v", a, b)
+		}
+		if hasMax(a) || hasMax(b) {
+			continue
+		}
+		if !checkOrder(t, a, b) {
+			t.FailNow()
+		}
+	}
+}
+
+func TestDescOrder(t *testing.T) {
+	checks := []interface{}{
+		func(a, b string) bool { return checkOrder(t, Desc{String(a)}, Desc{String(b)}) },
+		func(a1, b1 string, a2, b2 int64, a3, b3 []byte) bool {
+			return checkOrder(t, Tuple{String(a1), Desc{Int(a2)}, Bytes(a3)}, Tuple{String(b1), Desc{Int(b2)}, Bytes(b3)})
+		},
+		func(a, b []byte) bool {
+			return checkOrder(t, Tuple{Desc{Tuple{Bytes(a)}}, Int(1)}, Tuple{Desc{Tuple{Bytes(b)}}, Int(1)})
+		},
+	}
+	for _, check := range checks {
+		if err := quick.Check(check, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if (Desc{String("a")}).String() != "desc(a)" || (Tuple{String("a"), Desc{Int(1)}, Max}).String() != "(a, desc(1), max)" {
+		t.Fatalf("Unexpected formatting of %v", Tuple{String("a"), Desc{Int(1)}, Max})
+	}
+}
+
+func TestTupleInvalid(t *testing.T) {
+	codec := TupleCodec(Of(Bytes{}), DescCodec(Of(Int(0))), Of(Bool(false)))
+	if _, err := codec.EncodeKey(Tuple{Bytes("a"), Max}); err == nil {
+		t.Fatalf("Expected Max not to be encodable")
+	}
+	if _, err := codec.EncodeKey(Tuple{Bytes("a"), Desc{Int(1)}, Bool(true), Bool(true)}); err == nil {
+		t.Fatalf("Expected a Tuple longer than the codec to fail")
+	}
+	invalid := [][]byte{
+		{'a'},
+		{'a', 0x00},
+		{'a', 0x00, 0x02},
+		{'a', 0x00, 0x01, 0xff},
+		{'a', 0x00, 0x01, 0xff, 0xfe},
+		append(Tuple{Bytes("a"), Desc{Int(1)}}.MarshalKey(), 0x02, 0x00, 0x01),
+		append(Tuple{Bytes("a"), Desc{Int(1)}, Bool(true)}.MarshalKey(), 0x00, 0x01),
+	}
+	for _, b := range invalid {
+		if tuple, err := codec.DecodeKey(b); err == nil {
+			t.Fatalf("Expected %v to be invalid, got %v", b, tuple)
+		}
+	}
+}
+
+func TestTuplePrefixRange(t *testing.T) {
+	m := redblack.New(func(k smap.Key, v smap.Value) redblack.Entry { return &entry{k, v} })
+	for _, tuple := range sorted {
+		if !hasMax(tuple) {
+			m.Put(tuple, nil)
+		}
+	}
+	for _, prefix := range []Tuple{{Bytes("acme")}, {Bytes("acme"), Desc{Int(-1)}}, {Bytes{0x00}}, {}} {
+		expected := []Tuple{}
+		for _, tuple := range sorted {
+			if tuple.HasPrefix(prefix) && !hasMax(tuple) {
+				expected = append(expected, tuple)
+			}
+		}
+		got := []Tuple{}
+		for it := m.PrefixRange(prefix); it.Next(); {
+			got = append(got, it.Key().(Tuple))
+		}
+		if len(got) != len(expected) {
+			t.Fatalf("Expected %v, got %v", expected, got)
+		}
+		for i := range got {
+			if got[i].Cmp(expected[i]) != 0 || !prefix.IsPrefixOf(got[i]) {
+				t.Fatalf("Expected %v, got %v", expected, got)
+			}
+		}
+	}
+}
+
+//entry is a minimal redblack.Entry.
+type entry struct {
+	key   smap.Key
+	value smap.Value
+}
+
+func (e *entry) GetKey() smap.Key { return e.key }
+
+func (e *entry) GetValue() smap.Value { return e.value }
+
+func (e *entry) SetValue(v smap.Value) { e.value = v }
+
+func (e *entry) Size() int { return 0 }
+
+func (e *entry) Empty() bool { return false }
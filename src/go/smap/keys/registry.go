@@ -0,0 +1,124 @@
+package keys
+
+import (
+	"fmt"
+	"github.com/losmonos/stork/src/go/smap"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//encodableCodec encodes the keys of the same type as its prototype.
+type encodableCodec struct {
+	prototype smap.EncodableKey
+}
+
+//Of returns a KeyCodec for the keys of the same type as prototype.
+func Of(prototype smap.EncodableKey) smap.KeyCodec {
+	return encodableCodec{prototype}
+}
+
+func (c encodableCodec) EncodeKey(k smap.Key) ([]byte, error) {
+	e, ok := k.(smap.EncodableKey)
+	if !ok {
+		return nil, fmt.Errorf("keys: %T is not an EncodableKey", k)
+	}
+	return e.MarshalKey(), nil
+}
+
+func (c encodableCodec) DecodeKey(b []byte) (smap.Key, error) {
+	return c.prototype.UnmarshalKey(b)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]smap.KeyCodec{
+		"string": Of(String("")),
+		"bytes":  Of(Bytes{}),
+		"bool":   Of(Bool(false)),
+		"int":    Of(Int(0)),
+		"uint":   Of(Uint(0)),
+		"float":  Of(Float(0)),
+	}
+)
+
+//Register makes a KeyCodec available by name. It panics if the name is already taken
+//or is a tuple or desc name, which are resolved by Lookup().
+func Register(name string, c smap.KeyCodec) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := registry[name]; dup || strings.HasPrefix(name, "tuple(") || strings.HasPrefix(name, "desc(") {
+		panic("keys: Register called twice for " + name)
+	}
+	registry[name] = c
+}
+
+//Names returns the sorted names of the registered codecs.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//Lookup returns the KeyCodec registered as name. Names like "tuple(string,int)"
+//return a TupleCodec of the named element codecs, and "desc(int)" a DescCodec of the named codec.
+//They may be nested, as in "tuple(string,desc(int))".
+func Lookup(name string) (smap.KeyCodec, error) {
+	name = strings.TrimSpace(name)
+	if strings.HasPrefix(name, "desc(") && strings.HasSuffix(name, ")") {
+		c, err := Lookup(name[len("desc(") : len(name)-1])
+		if err != nil {
+			return nil, err
+		}
+		return DescCodec(c), nil
+	}
+	if strings.HasPrefix(name, "tuple(") && strings.HasSuffix(name, ")") {
+		elements, err := splitElements(name[len("tuple(") : len(name)-1])
+		if err != nil {
+			return nil, err
+		}
+		codecs := make([]smap.KeyCodec, len(elements))
+		for i, element := range elements {
+			if codecs[i], err = Lookup(element); err != nil {
+				return nil, err
+			}
+		}
+		return TupleCodec(codecs...), nil
+	}
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	if c, found := registry[name]; found {
+		return c, nil
+	}
+	return nil, fmt.Errorf("keys: unknown codec %q", name)
+}
+
+//splitElements splits a comma separated list of names, keeping nested tuples together.
+func splitElements(list string) ([]string, error) {
+	elements := []string{}
+	depth, start := 0, 0
+	for i, c := range list {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth < 0 {
+				return nil, fmt.Errorf("keys: unbalanced tuple %q", list)
+			}
+		case ',':
+			if depth == 0 {
+				elements = append(elements, list[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 || strings.TrimSpace(list) == "" {
+		return nil, fmt.Errorf("keys: invalid tuple %q", list)
+	}
+	return append(elements, list[start:]), nil
+}
@@ -0,0 +1,239 @@
+package keys
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/losmonos/stork/src/go/smap"
+	"strings"
+)
+
+//Tuple is a composite key, compared element by element. A Tuple sorts before
+//the longer Tuples it is a prefix of, so its leading elements select a contiguous range
+//of keys, see IsPrefixOf. Elements are Keys of any type, the ones at the same position
+//being of the same type, Desc to sort an element in descending order, or Max.
+//Elements must be EncodableKeys to be marshalled.
+//
+//Every element is encoded with its 0x00 bytes escaped as 0x00 0xff, and terminated by 0x00 0x01,
+//so the encodings of the elements can be concatenated without losing their order.
+type Tuple []smap.Key
+
+//Cmp compares two Tuple Keys
+func (t Tuple) Cmp(other smap.Key) int {
+	o := other.(Tuple)
+	for i := 0; i < len(t) && i < len(o); i++ {
+		if cmp := compare(t[i], o[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	return len(t) - len(o)
+}
+
+//compare compares two elements, which may be Max.
+func compare(a, b smap.Key) int {
+	if b == Max && a != Max {
+		return -1
+	}
+	return a.Cmp(b)
+}
+
+func (t Tuple) MarshalKey() []byte {
+	buf := []byte{}
+	for _, e := range t {
+		buf = appendEscaped(buf, e.(smap.EncodableKey).MarshalKey())
+	}
+	return buf
+}
+
+//UnmarshalKey decodes a Tuple using the receiver elements as prototypes.
+//The decoded Tuple may be shorter than the receiver, but not longer.
+func (t Tuple) UnmarshalKey(b []byte) (smap.Key, error) {
+	codecs := make([]smap.KeyCodec, len(t))
+	for i, e := range t {
+		codecs[i] = Of(e.(smap.EncodableKey))
+	}
+	return TupleCodec(codecs...).DecodeKey(b)
+}
+
+//HasPrefix tells whether the Tuple starts with the elements of prefix.
+func (t Tuple) HasPrefix(prefix Tuple) bool {
+	return len(prefix) <= len(t) && t[:len(prefix)].Cmp(prefix) == 0
+}
+
+//IsPrefixOf tells whether k is a Tuple starting with the elements of t.
+func (t Tuple) IsPrefixOf(k smap.Key) bool {
+	return k.(Tuple).HasPrefix(t)
+}
+
+//PrefixEnd returns t followed by Max, which sorts after all the Tuples starting with t.
+func (t Tuple) PrefixEnd() smap.Key {
+	return append(append(Tuple{}, t...), Max)
+}
+
+//String formats the Tuple like (lemon, 1, desc(2)).
+func (t Tuple) String() string {
+	elements := make([]string, len(t))
+	for i, e := range t {
+		elements[i] = fmt.Sprint(e)
+	}
+	return "(" + strings.Join(elements, ", ") + ")"
+}
+
+//appendEscaped appends an element escaping its 0x00 bytes, along with the terminator.
+func appendEscaped(buf, element []byte) []byte {
+	for _, c := range element {
+		if c == 0x00 {
+			buf = append(buf, 0x00, 0xff)
+		} else {
+			buf = append(buf, c)
+		}
+	}
+	return append(buf, 0x00, 0x01)
+}
+
+//readEscaped parses an escaped element, returning it and the remaining bytes.
+func readEscaped(b []byte) ([]byte, []byte, error) {
+	element := []byte{}
+	for {
+		i := bytes.IndexByte(b, 0x00)
+		if i < 0 || i+1 == len(b) {
+			return nil, nil, ErrInvalid
+		}
+		element = append(element, b[:i]...)
+		switch b[i+1] {
+		case 0x01:
+			return element, b[i+2:], nil
+		case 0xff:
+			element = append(element, 0x00)
+			b = b[i+2:]
+		default:
+			return nil, nil, ErrInvalid
+		}
+	}
+}
+
+//Desc wraps a Key to sort it in descending order. It is encoded as the escaped and
+//terminated encoding of the Key, like a Tuple element, with all its bits flipped.
+type Desc struct {
+	Key smap.Key
+}
+
+//Cmp compares two Desc Keys
+func (d Desc) Cmp(other smap.Key) int {
+	return -d.Key.Cmp(other.(Desc).Key)
+}
+
+func (d Desc) MarshalKey() []byte {
+	return flip(appendEscaped(nil, d.Key.(smap.EncodableKey).MarshalKey()))
+}
+
+//UnmarshalKey decodes a Desc using the receiver Key as prototype.
+func (d Desc) UnmarshalKey(b []byte) (smap.Key, error) {
+	return DescCodec(Of(d.Key.(smap.EncodableKey))).DecodeKey(b)
+}
+
+func (d Desc) String() string {
+	return fmt.Sprintf("desc(%v)", d.Key)
+}
+
+//flip flips all the bits of b, in place.
+func flip(b []byte) []byte {
+	for i := range b {
+		b[i] = ^b[i]
+	}
+	return b
+}
+
+//max is the type of Max.
+type max struct{}
+
+//Max is a Tuple element that sorts after any other. It has no encoding,
+//so Tuples holding it can be used as bounds of intervals, but not stored.
+var Max smap.Key = max{}
+
+//Cmp compares Max to another Tuple element.
+func (max) Cmp(other smap.Key) int {
+	if other == Max {
+		return 0
+	}
+	return 1
+}
+
+func (max) String() string { return "max" }
+
+//tupleCodec encodes Tuples with a codec per element.
+type tupleCodec []smap.KeyCodec
+
+//TupleCodec returns a KeyCodec for Tuples which elements are encoded by the given codecs.
+//The element codecs must preserve order, as the ones returned by Of() do.
+func TupleCodec(elements ...smap.KeyCodec) smap.KeyCodec {
+	return tupleCodec(elements)
+}
+
+func (c tupleCodec) EncodeKey(k smap.Key) ([]byte, error) {
+	t, ok := k.(Tuple)
+	if !ok || len(t) > len(c) {
+		return nil, ErrInvalid
+	}
+	buf := []byte{}
+	for i, e := range t {
+		element, err := c[i].EncodeKey(e)
+		if err != nil {
+			return nil, err
+		}
+		buf = appendEscaped(buf, element)
+	}
+	return buf, nil
+}
+
+func (c tupleCodec) DecodeKey(b []byte) (smap.Key, error) {
+	t := Tuple{}
+	for len(b) > 0 {
+		if len(t) == len(c) {
+			return nil, ErrInvalid
+		}
+		element, rest, err := readEscaped(b)
+		if err != nil {
+			return nil, err
+		}
+		e, err := c[len(t)].DecodeKey(element)
+		if err != nil {
+			return nil, err
+		}
+		t, b = append(t, e), rest
+	}
+	return t, nil
+}
+
+//descCodec encodes Desc keys wrapping the keys of another codec.
+type descCodec struct {
+	key smap.KeyCodec
+}
+
+//DescCodec returns a KeyCodec for Desc keys wrapping the keys encoded by c.
+func DescCodec(c smap.KeyCodec) smap.KeyCodec {
+	return descCodec{c}
+}
+
+func (c descCodec) EncodeKey(k smap.Key) ([]byte, error) {
+	d, ok := k.(Desc)
+	if !ok {
+		return nil, ErrInvalid
+	}
+	encoded, err := c.key.EncodeKey(d.Key)
+	if err != nil {
+		return nil, err
+	}
+	return flip(appendEscaped(nil, encoded)), nil
+}
+
+func (c descCodec) DecodeKey(b []byte) (smap.Key, error) {
+	encoded, rest, err := readEscaped(flip(append([]byte{}, b...)))
+	if err != nil || len(rest) > 0 {
+		return nil, ErrInvalid
+	}
+	k, err := c.key.DecodeKey(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return Desc{k}, nil
+}
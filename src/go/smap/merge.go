@@ -0,0 +1,219 @@
+package smap
+
+import (
+	"container/heap"
+	"io"
+)
+
+//MergeOptions configures a MergeIterator.
+//Reverse must be set when the sources iterate in descending order.
+//Tombstones tells whether deleted entries are yielded (see TombstoneIterator) or dropped.
+//Operator, if set, resolves Operands values against the older versions of their key.
+//Operands with no older value are yielded folded when Tombstones is set, as the value may live
+//outside the sources, and fully merged otherwise.
+type MergeOptions struct {
+	Reverse    bool
+	Tombstones bool
+	Operator   MergeOperator
+}
+
+//mergeSource is a source iterator along with its current key and priority.
+//The key is nil once the source is exhausted. passed is the last key the source was moved past.
+type mergeSource struct {
+	it       Iterator
+	key      Key
+	passed   Key
+	priority int
+}
+
+//next moves the source one step, returning false once it's exhausted.
+func (s *mergeSource) next() bool {
+	s.passed = s.key
+	if s.it.Next() {
+		s.key = s.it.Key()
+	} else {
+		s.key = nil
+	}
+	return s.key != nil
+}
+
+//mergeHeap orders the sources by their current key, and by priority on equal keys.
+type mergeHeap struct {
+	sources []*mergeSource
+	reverse bool
+}
+
+func (h *mergeHeap) Len() int { return len(h.sources) }
+
+func (h *mergeHeap) Less(i, j int) bool {
+	cmp := h.sources[i].key.Cmp(h.sources[j].key)
+	if h.reverse {
+		cmp = -cmp
+	}
+	return cmp < 0 || (cmp == 0 && h.sources[i].priority < h.sources[j].priority)
+}
+
+func (h *mergeHeap) Swap(i, j int) { h.sources[i], h.sources[j] = h.sources[j], h.sources[i] }
+
+func (h *mergeHeap) Push(x interface{}) { h.sources = append(h.sources, x.(*mergeSource)) }
+
+func (h *mergeHeap) Pop() interface{} {
+	last := h.sources[len(h.sources)-1]
+	h.sources = h.sources[:len(h.sources)-1]
+	return last
+}
+
+//MergeIterator merges several ordered Iterators into a single ordered stream.
+//When more than one source holds the same key, the one given first wins and the rest are skipped,
+//so sources should be given from newest to oldest.
+//Sources implementing TombstoneIterator can shadow older sources with deletions.
+//MergeIterator implements TombstoneIterator and SeekableIterator, but it can only Seek() backwards
+//if all its sources are SeekableIterators.
+type MergeIterator struct {
+	heap      mergeHeap
+	sources   []*mergeSource
+	opts      MergeOptions
+	key       Key
+	value     Value
+	tombstone bool
+}
+
+//NewMergeIterator builds a MergeIterator over sources, which are ordered by priority: newest first.
+func NewMergeIterator(sources []Iterator, opts MergeOptions) *MergeIterator {
+	m := &MergeIterator{opts: opts, heap: mergeHeap{reverse: opts.Reverse}}
+	for i, it := range sources {
+		source := &mergeSource{it: it, priority: i}
+		m.sources = append(m.sources, source)
+		if it.Next() {
+			source.key = it.Key()
+			m.heap.sources = append(m.heap.sources, source)
+		}
+	}
+	heap.Init(&m.heap)
+	return m
+}
+
+//advance moves the top source one step, dropping it once exhausted.
+func (m *MergeIterator) advance() {
+	if m.heap.sources[0].next() {
+		heap.Fix(&m.heap, 0)
+	} else {
+		heap.Pop(&m.heap)
+	}
+}
+
+//Next advances the iterator one step and if returns true, an entry will be available upon calling Key() and Value()
+func (m *MergeIterator) Next() bool {
+	for m.heap.Len() > 0 {
+		top := m.heap.sources[0]
+		m.key, m.value, m.tombstone = top.key, top.it.Value(), isTombstone(top.it)
+		m.advance()
+		operands, pending := m.value.(Operands)
+		pending = pending && m.opts.Operator != nil && !m.tombstone
+		//skip the older versions of the same key, resolving pending operands with them
+		for m.heap.Len() > 0 && m.heap.sources[0].key.Cmp(m.key) == 0 {
+			if pending {
+				operands, pending = m.resolve(m.heap.sources[0].it, operands)
+			}
+			m.advance()
+		}
+		if pending && m.opts.Tombstones {
+			m.value = operands.Fold(m.opts.Operator, m.key)
+		} else if pending {
+			m.value = m.opts.Operator.FullMerge(m.key, nil, false, operands)
+		}
+		if m.opts.Tombstones || !m.tombstone {
+			return true
+		}
+	}
+	return false
+}
+
+//resolve applies operands to the older version of the current key in it.
+//It returns the operands prepended with the older ones, and true, if the older version holds more operands.
+//Otherwise the merged value is stored as the current one.
+func (m *MergeIterator) resolve(it Iterator, operands Operands) (Operands, bool) {
+	if isTombstone(it) {
+		m.value = m.opts.Operator.FullMerge(m.key, nil, false, operands)
+		return nil, false
+	}
+	if older, ok := it.Value().(Operands); ok {
+		return append(append(Operands{}, older...), operands...), true
+	}
+	m.value = m.opts.Operator.FullMerge(m.key, it.Value(), true, operands)
+	return nil, false
+}
+
+//isTombstone tells whether the current element of an Iterator is a deletion marker.
+func isTombstone(it Iterator) bool {
+	t, ok := it.(TombstoneIterator)
+	return ok && t.Tombstone()
+}
+
+//Seek repositions all the sources, see SeekableIterator.
+//Sources which aren't SeekableIterators can only be moved forward, by calling Next() on them:
+//it panics if one of them was already moved past key.
+func (m *MergeIterator) Seek(key Key) bool {
+	m.heap.sources = m.heap.sources[:0]
+	for _, source := range m.sources {
+		if s, ok := source.it.(SeekableIterator); ok {
+			if !s.Seek(key) {
+				continue
+			}
+		} else if !m.skipTo(source, key) {
+			continue
+		}
+		source.key = source.it.Key()
+		m.heap.sources = append(m.heap.sources, source)
+	}
+	heap.Init(&m.heap)
+	return m.Next()
+}
+
+//skipTo moves a source with Next() up to the first key at or after key.
+//It returns false if the source is exhausted.
+func (m *MergeIterator) skipTo(source *mergeSource, key Key) bool {
+	if source.passed != nil && !m.before(source.passed, key) {
+		panic("smap: MergeIterator seeking backwards over a source which isn't a SeekableIterator")
+	}
+	for source.key != nil && m.before(source.key, key) {
+		source.next()
+	}
+	return source.key != nil
+}
+
+//before tells whether a comes before b in iteration order.
+func (m *MergeIterator) before(a, b Key) bool {
+	if m.opts.Reverse {
+		return a.Cmp(b) > 0
+	}
+	return a.Cmp(b) < 0
+}
+
+//Close closes the sources that implement io.Closer, returning the first error.
+func (m *MergeIterator) Close() error {
+	var err error
+	for _, source := range m.sources {
+		if closer, ok := source.it.(io.Closer); ok {
+			if closeErr := closer.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	return err
+}
+
+//Key returns the current key in the iterator.
+func (m *MergeIterator) Key() Key {
+	return m.key
+}
+
+//Value returns the current value in the iterator, from the newest source holding the key.
+func (m *MergeIterator) Value() Value {
+	return m.value
+}
+
+//Tombstone tells whether the current element is a deletion marker.
+func (m *MergeIterator) Tombstone() bool {
+	return m.tombstone
+}
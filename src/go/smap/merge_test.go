@@ -0,0 +1,202 @@
+package smap
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type number int
+
+//Cmp compares to int Keys
+func (n number) Cmp(other Key) int {
+	return int(n) - int(other.(number))
+}
+
+//sliceIterator iterates over a fixed list of keys, negative keys are tombstones.
+type sliceIterator struct {
+	keys   []int
+	name   string
+	pos    int
+	closed bool
+}
+
+func newSliceIterator(name string, keys ...int) *sliceIterator {
+	return &sliceIterator{keys: keys, name: name, pos: -1}
+}
+
+func (s *sliceIterator) Next() bool {
+	s.pos++
+	return s.pos < len(s.keys)
+}
+
+func (s *sliceIterator) Key() Key {
+	if k := s.keys[s.pos]; k < 0 {
+		return number(-k)
+	} else {
+		return number(k)
+	}
+}
+
+func (s *sliceIterator) Value() Value { return s.name }
+
+func (s *sliceIterator) Tombstone() bool { return s.keys[s.pos] < 0 }
+
+func (s *sliceIterator) Close() error {
+	s.closed = true
+	return nil
+}
+
+//seekableSliceIterator is a sliceIterator implementing SeekableIterator, its keys are in descending order if reverse is set.
+type seekableSliceIterator struct {
+	*sliceIterator
+	reverse bool
+}
+
+func (s *seekableSliceIterator) Seek(key Key) bool {
+	for s.pos = 0; s.pos < len(s.keys); s.pos++ {
+		if cmp := s.Key().Cmp(key); (cmp >= 0 && !s.reverse) || (cmp <= 0 && s.reverse) {
+			return true
+		}
+	}
+	return false
+}
+
+//collect drains an iterator as a list of key=value pairs, marking tombstones.
+func collect(it Iterator) string {
+	pairs := []string{}
+	for it.Next() {
+		if isTombstone(it) {
+			pairs = append(pairs, fmt.Sprintf("%v!", it.Key()))
+		} else {
+			pairs = append(pairs, fmt.Sprintf("%v=%v", it.Key(), it.Value()))
+		}
+	}
+	return strings.Join(pairs, " ")
+}
+
+func TestMergeIterator(t *testing.T) {
+	merged := NewMergeIterator([]Iterator{
+		newSliceIterator("new", 2, -4, 6),
+		newSliceIterator("mid", 1, 4, 6, 8),
+		newSliceIterator("old", 1, 2, 3, 9),
+	}, MergeOptions{})
+	if expected, got := "1=mid 2=new 3=old 6=new 8=mid 9=old", collect(merged); got != expected {
+		t.Fatalf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestMergeIteratorTombstones(t *testing.T) {
+	merged := NewMergeIterator([]Iterator{
+		newSliceIterator("new", -1, 3),
+		newSliceIterator("old", 1, 2, -3),
+	}, MergeOptions{Tombstones: true})
+	if expected, got := "1! 2=old 3=new", collect(merged); got != expected {
+		t.Fatalf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestMergeIteratorReverse(t *testing.T) {
+	merged := NewMergeIterator([]Iterator{
+		newSliceIterator("new", 6, -4, 2),
+		newSliceIterator("old", 9, 4, 2, 1),
+	}, MergeOptions{Reverse: true})
+	if expected, got := "9=old 6=new 2=new 1=old", collect(merged); got != expected {
+		t.Fatalf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestMergeIteratorEmpty(t *testing.T) {
+	if merged := NewMergeIterator(nil, MergeOptions{}); merged.Next() {
+		t.Fatalf("Expected empty merge, got %v", merged.Key())
+	}
+	merged := NewMergeIterator([]Iterator{newSliceIterator("a"), newSliceIterator("b", -1)}, MergeOptions{})
+	if merged.Next() {
+		t.Fatalf("Expected empty merge, got %v", merged.Key())
+	}
+}
+
+func TestMergeIteratorSeekForward(t *testing.T) {
+	merged := NewMergeIterator([]Iterator{
+		newSliceIterator("new", 2, 5, 8),
+		newSliceIterator("old", 1, 5, 7, 9),
+	}, MergeOptions{})
+	if !merged.Seek(number(5)) || merged.Key() != number(5) || merged.Value() != "new" {
+		t.Fatalf("Expected Seek(5) to land on 5=new")
+	}
+	if expected, got := "7=old 8=new 9=old", collect(merged); got != expected {
+		t.Fatalf("Expected %q, got %q", expected, got)
+	}
+	if merged.Seek(number(10)) {
+		t.Fatalf("Expected Seek past the end to fail, got %v", merged.Key())
+	}
+}
+
+func TestMergeIteratorSeekBackward(t *testing.T) {
+	merged := NewMergeIterator([]Iterator{
+		&seekableSliceIterator{sliceIterator: newSliceIterator("new", 3, -4)},
+		&seekableSliceIterator{sliceIterator: newSliceIterator("old", 1, 2, 3, 4, 5)},
+	}, MergeOptions{})
+	collect(merged)
+	if !merged.Seek(number(2)) || merged.Key() != number(2) || merged.Value() != "old" {
+		t.Fatalf("Expected Seek(2) to land on 2=old")
+	}
+	if expected, got := "3=new 5=old", collect(merged); got != expected {
+		t.Fatalf("Expected %q, got %q", expected, got)
+	}
+
+	merged = NewMergeIterator([]Iterator{
+		&seekableSliceIterator{sliceIterator: newSliceIterator("new", -4, 3), reverse: true},
+		&seekableSliceIterator{sliceIterator: newSliceIterator("old", 5, 4, 3, 2, 1), reverse: true},
+	}, MergeOptions{Reverse: true})
+	collect(merged)
+	if !merged.Seek(number(4)) || merged.Key() != number(3) || merged.Value() != "new" {
+		t.Fatalf("Expected a reverse Seek(4) to land on 3=new")
+	}
+	if expected, got := "2=old 1=old", collect(merged); got != expected {
+		t.Fatalf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestMergeIteratorSeekBackwardUnseekable(t *testing.T) {
+	merged := NewMergeIterator([]Iterator{
+		&seekableSliceIterator{sliceIterator: newSliceIterator("new", 3, -4)},
+		newSliceIterator("old", 1, 2, 3, 4, 5),
+	}, MergeOptions{})
+	if !merged.Seek(number(2)) || !merged.Next() || !merged.Seek(number(5)) {
+		t.Fatalf("Expected to seek forward")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("Expected seeking backwards to panic")
+		}
+	}()
+	merged.Seek(number(2))
+}
+
+func TestAllClosesOnBreak(t *testing.T) {
+	a, b := newSliceIterator("a", 1, 3, 5), newSliceIterator("b", 2, 4)
+	keys := []Key{}
+	for k, v := range All(NewMergeIterator([]Iterator{a, b}, MergeOptions{})) {
+		if keys = append(keys, k); k == number(3) {
+			if v != "a" {
+				t.Fatalf("Expected 3 to come from a, got %v", v)
+			}
+			break
+		}
+	}
+	if fmt.Sprint(keys) != "[1 2 3]" {
+		t.Fatalf("Expected [1 2 3], got %v", keys)
+	}
+	if !a.closed || !b.closed {
+		t.Fatalf("Expected breaking out of the loop to close the sources")
+	}
+	c := newSliceIterator("c", 1, 2)
+	n := 0
+	for range All(c) {
+		n++
+	}
+	if n != 2 || !c.closed {
+		t.Fatalf("Expected to visit 2 keys and close the iterator, got %d", n)
+	}
+}
@@ -0,0 +1,53 @@
+package smap
+
+//MergeOperator defines a read-modify-write update, applied by storing operands instead of values.
+//Operands are folded lazily, when a key is read, or eagerly when data is rewritten anyway.
+type MergeOperator interface {
+	//FullMerge applies operands, oldest first, to the existing value.
+	//found is false when there's no existing value, either because the key was never set or was deleted.
+	FullMerge(key Key, existing Value, found bool, operands []Value) Value
+	//PartialMerge combines two consecutive operands into one, if possible without the existing value.
+	PartialMerge(key Key, older, newer Value) (Value, bool)
+}
+
+//Operands are merge operands, oldest first, waiting for the value they apply to.
+//They are stored as values where the existing value of the key is not known yet,
+//and resolved by a MergeIterator with a MergeOperator.
+type Operands []Value
+
+//Fold combines the consecutive operands that op can partially merge.
+func (o Operands) Fold(op MergeOperator, key Key) Operands {
+	if len(o) < 2 {
+		return o
+	}
+	folded := Operands{o[0]}
+	for _, next := range o[1:] {
+		last := len(folded) - 1
+		if v, ok := op.PartialMerge(key, folded[last], next); ok {
+			folded[last] = v
+		} else {
+			folded = append(folded, next)
+		}
+	}
+	return folded
+}
+
+//Associative is a MergeOperator for updates which can be combined in any grouping,
+//such as counters or set unions. It merges two values, older first.
+type Associative func(key Key, older, newer Value) Value
+
+//FullMerge folds the operands into the existing value, or into the first operand when there's none.
+func (a Associative) FullMerge(key Key, existing Value, found bool, operands []Value) Value {
+	if !found {
+		existing, operands = operands[0], operands[1:]
+	}
+	for _, operand := range operands {
+		existing = a(key, existing, operand)
+	}
+	return existing
+}
+
+//PartialMerge always combines the operands.
+func (a Associative) PartialMerge(key Key, older, newer Value) (Value, bool) {
+	return a(key, older, newer), true
+}
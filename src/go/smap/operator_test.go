@@ -0,0 +1,78 @@
+package smap
+
+import (
+	"fmt"
+	"testing"
+)
+
+//concat is a MergeOperator appending string operands.
+var concat = Associative(func(key Key, older, newer Value) Value { return older.(string) + newer.(string) })
+
+//patch is a MergeOperator whose operands can't be combined without the existing value.
+type patch struct{}
+
+func (patch) FullMerge(key Key, existing Value, found bool, operands []Value) Value {
+	return fmt.Sprintf("%v %v %v", existing, found, operands)
+}
+
+func (patch) PartialMerge(key Key, older, newer Value) (Value, bool) { return nil, false }
+
+//valueIterator iterates over fixed entries, nil values are tombstones.
+type valueIterator struct {
+	keys   []int
+	values []Value
+	pos    int
+}
+
+func newValueIterator(pairs ...interface{}) *valueIterator {
+	it := &valueIterator{pos: -1}
+	for i := 0; i < len(pairs); i += 2 {
+		it.keys = append(it.keys, pairs[i].(int))
+		it.values = append(it.values, pairs[i+1])
+	}
+	return it
+}
+
+func (v *valueIterator) Next() bool {
+	v.pos++
+	return v.pos < len(v.keys)
+}
+
+func (v *valueIterator) Key() Key { return number(v.keys[v.pos]) }
+
+func (v *valueIterator) Value() Value { return v.values[v.pos] }
+
+func (v *valueIterator) Tombstone() bool { return v.values[v.pos] == nil }
+
+func operandSources() []Iterator {
+	return []Iterator{
+		newValueIterator(1, Operands{"c"}, 2, Operands{"x"}, 3, Operands{"z"}, 4, "w"),
+		newValueIterator(1, Operands{"b"}, 2, nil, 3, Operands{"y"}, 4, Operands{"v"}),
+		newValueIterator(1, "a", 2, "old"),
+	}
+}
+
+func TestMergeIteratorOperands(t *testing.T) {
+	merged := NewMergeIterator(operandSources(), MergeOptions{Operator: concat})
+	if expected, got := "1=abc 2=x 3=yz 4=w", collect(merged); got != expected {
+		t.Fatalf("Expected %q, got %q", expected, got)
+	}
+	merged = NewMergeIterator(operandSources(), MergeOptions{Operator: concat, Tombstones: true})
+	if expected, got := "1=abc 2=x 3=[yz] 4=w", collect(merged); got != expected {
+		t.Fatalf("Expected %q, got %q", expected, got)
+	}
+	merged = NewMergeIterator(operandSources(), MergeOptions{Operator: patch{}})
+	if expected, got := "1=a true [b c] 2=<nil> false [x] 3=<nil> false [y z] 4=w", collect(merged); got != expected {
+		t.Fatalf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestFoldOperands(t *testing.T) {
+	operands := Operands{"a", "b", "c"}
+	if folded := operands.Fold(concat, number(1)); fmt.Sprint(folded) != "[abc]" {
+		t.Fatalf("Expected the operands to be combined, got %v", folded)
+	}
+	if folded := operands.Fold(patch{}, number(1)); fmt.Sprint(folded) != "[a b c]" {
+		t.Fatalf("Expected the operands to be kept, got %v", folded)
+	}
+}
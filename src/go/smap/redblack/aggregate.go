@@ -0,0 +1,94 @@
+package redblack
+
+import (
+	"github.com/losmonos/stork/src/go/smap"
+	"math"
+)
+
+//Aggregator is a monoid over entries, such as a sum of values or their total size.
+//Combine must be associative and Identity its neutral element. Combine needs not be
+//commutative: its arguments always come in key order. Lift maps a non empty entry to
+//its aggregate, empty entries are ignored.
+type Aggregator interface {
+	Identity() interface{}
+	Combine(a, b interface{}) interface{}
+	Lift(e Entry) interface{}
+}
+
+//SetAggregator makes every node keep the aggregate of its subtree, which lets Aggregate()
+//answer in O(log n). The aggregates are computed for the existing nodes, which is O(n),
+//and maintained on every change from then on. A nil Aggregator drops them.
+func (m *RedBlack) SetAggregator(a Aggregator) {
+	m.tree.summary.aggregator, m.tree.summary.lift = a, nil
+	if a != nil {
+		m.tree.summary.lift = func(e Entry) interface{} { return lift(a, e) }
+	}
+	m.tree.resummarize()
+}
+
+//lift returns the aggregate of a single entry.
+func lift(a Aggregator, e Entry) interface{} {
+	if e.Empty() {
+		return a.Identity()
+	}
+	return a.Lift(e)
+}
+
+//Aggregate combines the entries within the interval in O(log n).
+//It returns nil if there's no Aggregator, see SetAggregator().
+func (m *RedBlack) Aggregate(i smap.Interval) interface{} {
+	if m.tree.summary.aggregator == nil {
+		return nil
+	}
+	from, to := bound(i.From), bound(i.To)
+	return m.tree.aggregateRange(m.tree.root, from, to, !from.bounded, !to.bounded)
+}
+
+//funcAggregator builds an Aggregator out of its parts.
+type funcAggregator struct {
+	identity interface{}
+	combine  func(a, b interface{}) interface{}
+	lift     func(e Entry) interface{}
+}
+
+func (f funcAggregator) Identity() interface{} { return f.identity }
+
+func (f funcAggregator) Combine(a, b interface{}) interface{} { return f.combine(a, b) }
+
+func (f funcAggregator) Lift(e Entry) interface{} { return f.lift(e) }
+
+//SizeAggregator sums Entry.Size() as an int: the total bytes of an interval.
+var SizeAggregator Aggregator = funcAggregator{
+	identity: 0,
+	combine:  func(a, b interface{}) interface{} { return a.(int) + b.(int) },
+	lift:     func(e Entry) interface{} { return e.Size() },
+}
+
+//SumAggregator sums a number taken from every entry, as a float64.
+func SumAggregator(value func(Entry) float64) Aggregator {
+	return funcAggregator{
+		identity: 0.0,
+		combine:  func(a, b interface{}) interface{} { return a.(float64) + b.(float64) },
+		lift:     func(e Entry) interface{} { return value(e) },
+	}
+}
+
+//MinAggregator keeps the minimum of a number taken from every entry, as a float64.
+//The minimum of an empty interval is +Inf.
+func MinAggregator(value func(Entry) float64) Aggregator {
+	return funcAggregator{
+		identity: math.Inf(1),
+		combine:  func(a, b interface{}) interface{} { return math.Min(a.(float64), b.(float64)) },
+		lift:     func(e Entry) interface{} { return value(e) },
+	}
+}
+
+//MaxAggregator keeps the maximum of a number taken from every entry, as a float64.
+//The maximum of an empty interval is -Inf.
+func MaxAggregator(value func(Entry) float64) Aggregator {
+	return funcAggregator{
+		identity: math.Inf(-1),
+		combine:  func(a, b interface{}) interface{} { return math.Max(a.(float64), b.(float64)) },
+		lift:     func(e Entry) interface{} { return value(e) },
+	}
+}
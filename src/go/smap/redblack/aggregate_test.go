@@ -0,0 +1,76 @@
+package redblack
+
+import (
+	"fmt"
+	"github.com/losmonos/stork/src/go/smap"
+	"math/rand"
+	"testing"
+)
+
+//concat is a non commutative Aggregator joining the values in order.
+type concat struct{}
+
+func (concat) Identity() interface{} { return "" }
+
+func (concat) Combine(a, b interface{}) interface{} { return a.(string) + b.(string) }
+
+func (concat) Lift(e Entry) interface{} { return fmt.Sprint(e.GetValue(), ",") }
+
+func value(e Entry) float64 { return float64(e.GetValue().(int)) }
+
+func TestAggregate(t *testing.T) {
+	aggregators := []Aggregator{concat{}, SumAggregator(value), MinAggregator(value), MaxAggregator(value), SizeAggregator}
+	for _, tombstones := range []bool{false, true} {
+		for _, a := range aggregators {
+			m := New(nnFactory)
+			if tombstones {
+				m = NewWithTombstones(nnFactory)
+			}
+			r := rand.New(rand.NewSource(1))
+			for i := 0; i < 2000; i++ {
+				//the aggregator is set halfway to check the existing nodes get their aggregates
+				if i == 1000 {
+					m.SetAggregator(a)
+				}
+				k := r.Intn(200)
+				if r.Intn(3) == 0 {
+					m.Delete(number(k))
+				} else {
+					m.Put(number(k), r.Intn(1000)-500)
+				}
+			}
+			for n := 0; n < 300; n++ {
+				i := smap.Interval{}
+				if r.Intn(4) > 0 {
+					i.From = smap.Edge{Key: number(r.Intn(220) - 10), Open: r.Intn(2) == 0}
+				}
+				if r.Intn(4) > 0 {
+					i.To = smap.Edge{Key: number(r.Intn(220) - 10), Open: r.Intn(2) == 0}
+				}
+				expected := a.Identity()
+				if i.From == smap.Inf || i.To == smap.Inf || i.From.Key.Cmp(i.To.Key) <= 0 {
+					for it := m.Range(i); it.Next(); {
+						expected = a.Combine(expected, a.Lift(&nn{it.Key().(number), it.Value().(int)}))
+					}
+				}
+				if got := m.Aggregate(i); got != expected {
+					t.Fatalf("Expected %v on %v, got %v", expected, i, got)
+				}
+			}
+		}
+	}
+}
+
+func TestNoAggregator(t *testing.T) {
+	m := New(nnFactory)
+	m.Put(number(1), 1)
+	if got := m.Aggregate(smap.Interval{}); got != nil {
+		t.Fatalf("Expected no aggregate, got %v", got)
+	}
+	m.SetAggregator(SumAggregator(value))
+	m.SetAggregator(nil)
+	m.Put(number(2), 2)
+	if got := m.Aggregate(smap.Interval{}); got != nil || m.tree.root.agg != nil {
+		t.Fatalf("Expected the aggregates to be dropped, got %v", got)
+	}
+}
@@ -1,5 +1,12 @@
 //Sorted map implementation based on a left-leaning red-black tree.
-//It supports Get(), Put() and Scan(). Currently there's no Delete() implementation.
+//It supports Get(), Put(), Delete() and Scan(), along with Floor(), Ceiling() and the like.
+//In tombstone mode (see NewWithTombstones) deleted keys are kept as empty entries,
+//so the map can be flushed on top of older data without resurrecting it.
+//Nodes keep the amount of keys in their subtree, so Rank(), Select() and CountInterval() are O(log n).
+//They can also keep a user defined aggregate of their subtree, see Aggregator.
+//Persistent RedBlacks copy the nodes they change instead of modifying them, so Snapshot() is O(1).
+//The tree itself is Map, a type safe sorted map with typed keys, values and iterators:
+//RedBlack is a Map of Entries keyed by smap.Key, which adds the entry semantics on top.
 package redblack
 
 import (
@@ -0,0 +1,7 @@
+//Ready to use Entry implementations for RedBlack, along with their EntryFactory.
+//Bytes and String replace the value on Put, Counter adds to it, LastWriterWins keeps
+//the value with the latest timestamp and Multi keeps every value put.
+//
+//Sizes count the key and the value bytes, see KeySize. Every entry implements
+//redblack.CopyableEntry, so persistent RedBlacks update them without losing their state.
+package entries
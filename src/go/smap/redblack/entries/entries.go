@@ -0,0 +1,196 @@
+package entries
+
+import (
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/smap/redblack"
+	"reflect"
+)
+
+//KeySize returns the size of a key: the length of string and byte slice keys,
+//the length of the encoding of other smap.EncodableKeys and 8 for anything else.
+//Entries compute it once, when they are built.
+func KeySize(key smap.Key) int {
+	if n, ok := bytesLen(key); ok {
+		return n
+	}
+	if k, ok := key.(smap.EncodableKey); ok {
+		return len(k.MarshalKey())
+	}
+	return 8
+}
+
+//valueSize returns the length of string and byte slice values and 8 for anything else.
+func valueSize(v smap.Value) int {
+	if n, ok := bytesLen(v); ok {
+		return n
+	}
+	return 8
+}
+
+//bytesLen returns the length of x if it's a string or a byte slice, of any named type.
+func bytesLen(x interface{}) (int, bool) {
+	v := reflect.ValueOf(x)
+	switch {
+	case v.Kind() == reflect.String:
+		return v.Len(), true
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return v.Len(), true
+	}
+	return 0, false
+}
+
+//Bytes is an entry holding a byte slice, which Put replaces.
+type Bytes struct {
+	key     smap.Key
+	keySize int
+	value   []byte
+}
+
+//BytesFactory builds Bytes entries, the value must be a []byte.
+func BytesFactory(key smap.Key, value smap.Value) redblack.Entry {
+	return &Bytes{key, KeySize(key), value.([]byte)}
+}
+
+func (e *Bytes) GetKey() smap.Key { return e.key }
+
+func (e *Bytes) GetValue() smap.Value { return e.value }
+
+func (e *Bytes) SetValue(v smap.Value) { e.value = v.([]byte) }
+
+func (e *Bytes) Size() int { return e.keySize + len(e.value) }
+
+func (e *Bytes) Empty() bool { return false }
+
+//Copy returns a copy of the entry. The byte slice is shared, as SetValue replaces it.
+func (e *Bytes) Copy() redblack.Entry { c := *e; return &c }
+
+//String is an entry holding a string, which Put replaces.
+type String struct {
+	key     smap.Key
+	keySize int
+	value   string
+}
+
+//StringFactory builds String entries, the value must be a string.
+func StringFactory(key smap.Key, value smap.Value) redblack.Entry {
+	return &String{key, KeySize(key), value.(string)}
+}
+
+func (e *String) GetKey() smap.Key { return e.key }
+
+func (e *String) GetValue() smap.Value { return e.value }
+
+func (e *String) SetValue(v smap.Value) { e.value = v.(string) }
+
+func (e *String) Size() int { return e.keySize + len(e.value) }
+
+func (e *String) Empty() bool { return false }
+
+func (e *String) Copy() redblack.Entry { c := *e; return &c }
+
+//Counter is an entry holding an int64, to which Put adds.
+type Counter struct {
+	key     smap.Key
+	keySize int
+	value   int64
+}
+
+//CounterFactory builds Counter entries, the value must be an int64.
+func CounterFactory(key smap.Key, value smap.Value) redblack.Entry {
+	return &Counter{key, KeySize(key), value.(int64)}
+}
+
+func (e *Counter) GetKey() smap.Key { return e.key }
+
+func (e *Counter) GetValue() smap.Value { return e.value }
+
+//SetValue adds v, which must be an int64, to the counter.
+func (e *Counter) SetValue(v smap.Value) { e.value += v.(int64) }
+
+func (e *Counter) Size() int { return e.keySize + 8 }
+
+func (e *Counter) Empty() bool { return false }
+
+func (e *Counter) Copy() redblack.Entry { c := *e; return &c }
+
+//Stamped is a value along with the time it was written at, as used by LastWriterWins.
+type Stamped struct {
+	Value     smap.Value
+	Timestamp int64
+}
+
+//LastWriterWins is an entry holding a Stamped value, Put replaces it only with a newer one.
+//Ties go to the latest Put, so replicas applying the same writes must agree on their order
+//or on unique timestamps.
+type LastWriterWins struct {
+	key     smap.Key
+	keySize int
+	value   Stamped
+}
+
+//LastWriterWinsFactory builds LastWriterWins entries, the value must be a Stamped.
+func LastWriterWinsFactory(key smap.Key, value smap.Value) redblack.Entry {
+	return &LastWriterWins{key, KeySize(key), value.(Stamped)}
+}
+
+func (e *LastWriterWins) GetKey() smap.Key { return e.key }
+
+//GetValue returns the Stamped value.
+func (e *LastWriterWins) GetValue() smap.Value { return e.value }
+
+//SetValue replaces the value with v, which must be a Stamped, unless v is older.
+func (e *LastWriterWins) SetValue(v smap.Value) {
+	if s := v.(Stamped); s.Timestamp >= e.value.Timestamp {
+		e.value = s
+	}
+}
+
+func (e *LastWriterWins) Size() int { return e.keySize + valueSize(e.value.Value) + 8 }
+
+func (e *LastWriterWins) Empty() bool { return false }
+
+func (e *LastWriterWins) Copy() redblack.Entry { c := *e; return &c }
+
+//Multi is an entry holding every value put on its key, in order.
+type Multi struct {
+	key     smap.Key
+	keySize int
+	values  []smap.Value
+	size    int
+}
+
+//MultiFactory builds Multi entries, holding just the given value.
+func MultiFactory(key smap.Key, value smap.Value) redblack.Entry {
+	return &Multi{key, KeySize(key), []smap.Value{value}, valueSize(value)}
+}
+
+func (e *Multi) GetKey() smap.Key { return e.key }
+
+//GetValue returns the values as a []smap.Value, which must not be modified.
+func (e *Multi) GetValue() smap.Value { return e.values }
+
+//SetValue appends v to the values.
+func (e *Multi) SetValue(v smap.Value) {
+	e.values = append(e.values, v)
+	e.size += valueSize(v)
+}
+
+func (e *Multi) Size() int { return e.keySize + e.size }
+
+func (e *Multi) Empty() bool { return false }
+
+//Copy returns a copy of the entry, with its own values slice.
+func (e *Multi) Copy() redblack.Entry {
+	c := *e
+	c.values = append([]smap.Value{}, e.values...)
+	return &c
+}
+
+//enforce the entries implement CopyableEntry
+var (
+	_ redblack.CopyableEntry = &Bytes{}
+	_ redblack.CopyableEntry = &String{}
+	_ redblack.CopyableEntry = &Counter{}
+	_ redblack.CopyableEntry = &LastWriterWins{}
+	_ redblack.CopyableEntry = &Multi{}
+)
@@ -0,0 +1,80 @@
+package entries
+
+import (
+	"fmt"
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/smap/keys"
+	"github.com/losmonos/stork/src/go/smap/redblack"
+	"testing"
+)
+
+//name is a string key which is not an EncodableKey.
+type name string
+
+func (n name) Cmp(other smap.Key) int {
+	if n < other.(name) {
+		return -1
+	} else if n > other.(name) {
+		return 1
+	}
+	return 0
+}
+
+func TestKeySize(t *testing.T) {
+	tuple := keys.Tuple{keys.String("a"), keys.Int(1)}
+	cases := []struct {
+		key      smap.Key
+		expected int
+	}{
+		{keys.String("lemon"), 5},
+		{name("orange"), 6},
+		{keys.Int(-1), 8},
+		{tuple, len(tuple.MarshalKey())},
+	}
+	for _, c := range cases {
+		if got := KeySize(c.key); got != c.expected {
+			t.Errorf("Expected %v to take %d bytes, got %d", c.key, c.expected, got)
+		}
+	}
+}
+
+func TestEntries(t *testing.T) {
+	cases := []struct {
+		factory  redblack.EntryFactory
+		values   []smap.Value
+		expected string
+		size     int
+	}{
+		{BytesFactory, []smap.Value{[]byte("one"), []byte("three")}, "[116 104 114 101 101]", 3 + 5},
+		{StringFactory, []smap.Value{"one", "three"}, "three", 3 + 5},
+		{CounterFactory, []smap.Value{int64(2), int64(3), int64(-1)}, "4", 3 + 8},
+		{LastWriterWinsFactory, []smap.Value{Stamped{"b", 2}, Stamped{"a", 1}, Stamped{"c", 2}}, "{c 2}", 3 + 1 + 8},
+		{MultiFactory, []smap.Value{"one", "two", 3}, "[one two 3]", 3 + 3 + 3 + 8},
+	}
+	for _, c := range cases {
+		key := keys.String("key")
+		m := redblack.New(c.factory)
+		//persistent RedBlacks update copies of the entries, leaving the snapshots untouched
+		p := redblack.NewPersistent(c.factory)
+		m.Put(key, c.values[0])
+		p.Put(key, c.values[0])
+		snapshot := p.Snapshot()
+		first := fmt.Sprint(snapshot.Get(key))
+		for _, v := range c.values[1:] {
+			m.Put(key, v)
+			p.Put(key, v)
+		}
+		for _, r := range []smap.SMapReader{m, p} {
+			v, _ := r.Get(key)
+			if got := fmt.Sprint(v); got != c.expected {
+				t.Errorf("Expected %s, got %s", c.expected, got)
+			}
+			if r.Size() != c.size {
+				t.Errorf("Expected %s to take %d bytes, got %d", c.expected, c.size, r.Size())
+			}
+		}
+		if got := fmt.Sprint(snapshot.Get(key)); got != first {
+			t.Errorf("Expected the snapshot to keep %s, got %s", first, got)
+		}
+	}
+}
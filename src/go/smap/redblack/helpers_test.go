@@ -16,6 +16,21 @@ func (s str) Cmp(other smap.Key) int {
 	return bytes.Compare([]byte(string(s)), []byte(string(other.(str))))
 }
 
+//IsPrefixOf tells whether k starts with s
+func (s str) IsPrefixOf(k smap.Key) bool {
+	return bytes.HasPrefix([]byte(string(k.(str))), []byte(string(s)))
+}
+
+//PrefixEnd increments the last byte of s that isn't 0xff, dropping the ones after it
+func (s str) PrefixEnd() smap.Key {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] != 0xff {
+			return s[:i] + str([]byte{s[i] + 1})
+		}
+	}
+	return nil
+}
+
 //ss implements a string to string Entry
 type ss struct {
 	key   str
@@ -99,16 +114,50 @@ var _ EntryFactory = nnFactory
 type visitor func(n *Node) bool
 
 //An in-order traversal of a Tree Node.
-func (n *Node) inOrder(visit visitor) {
+func (n *mapNode[K, V]) inOrder(visit func(n *mapNode[K, V]) bool) {
 	if n == nil {
 		return
 	}
-	n.Left.inOrder(visit)
+	n.left.inOrder(visit)
 	visit(n)
-	n.Right.inOrder(visit)
+	n.right.inOrder(visit)
 }
 
 //An in-order traversal of a RedBlack
 func (m *RedBlack) inOrder(f visitor) {
-	m.root.inOrder(f)
+	m.tree.root.inOrder(f)
+}
+
+//blackHeight checks the left-leaning red-black invariants of a subtree:
+//no red node has a red child, there are no red right childs
+//and all the paths to the leafs have the same amount of black nodes.
+//It returns the black height of the subtree, or -1 if any invariant doesn't hold.
+func (n *mapNode[K, V]) blackHeight() int {
+	if n == nil {
+		return 0
+	}
+	if n.isRed() && (n.left.isRed() || n.right.isRed()) {
+		return -1
+	}
+	if n.right.isRed() {
+		return -1
+	}
+	left, right := n.left.blackHeight(), n.right.blackHeight()
+	if left < 0 || left != right {
+		return -1
+	}
+	if n.isRed() {
+		return left
+	}
+	return left + 1
+}
+
+//isBalanced tells whether a Map holds the left-leaning red-black invariants.
+func (m *Map[K, V]) isBalanced() bool {
+	return !m.root.isRed() && m.root.blackHeight() >= 0
+}
+
+//isBalanced tells whether a RedBlack holds the left-leaning red-black invariants.
+func (m *RedBlack) isBalanced() bool {
+	return m.tree.isBalanced()
 }
@@ -0,0 +1,566 @@
+package redblack
+
+import (
+	"cmp"
+	"iter"
+)
+
+//mapNode is a node of the tree, holding the key and value in place.
+//count is the amount of counted values in the subtree rooted at the node, see summary,
+//and agg their aggregate when the Map has an Aggregator.
+//gen is the generation the node was created in, see own().
+type mapNode[K, V any] struct {
+	key         K
+	value       V
+	left, right *mapNode[K, V]
+	color       bool
+	count       int
+	agg         interface{}
+	gen         uint64
+}
+
+//XXX constants should be upper case, but what about unexported constants?
+const (
+	red   = false
+	black = true
+)
+
+//summary tells which values the nodes count in their subtrees, all of them if counted is nil,
+//and how to aggregate them, if aggregator is set.
+type summary[V any] struct {
+	counted    func(V) bool
+	aggregator Aggregator
+	lift       func(V) interface{}
+}
+
+//Map is a type safe sorted map on a left-leaning red-black tree, the one RedBlack is built upon.
+//Keys are compared with the function given to NewMapFunc, or their natural order for NewMap.
+//Put replaces values.
+//length is the amount of nodes. gen is bumped by snapshots, so nodes of older generations
+//are copied before being changed, see own().
+type Map[K, V any] struct {
+	root    *mapNode[K, V]
+	cmp     func(K, K) int
+	length  int
+	gen     uint64
+	summary summary[V]
+}
+
+//NewMap creates a Map ordered by the natural order of its keys.
+func NewMap[K cmp.Ordered, V any]() *Map[K, V] {
+	return NewMapFunc[K, V](cmp.Compare[K])
+}
+
+//NewMapFunc creates a Map ordered by cmp, which returns a negative number if a < b,
+//a positive one if a > b and zero if they are equal.
+func NewMapFunc[K, V any](cmp func(a, b K) int) *Map[K, V] {
+	return &Map[K, V]{cmp: cmp}
+}
+
+//isRed returns whether the node is red (or black). Nil nodes (empty leafs) are black
+func (n *mapNode[K, V]) isRed() bool {
+	return n != nil && n.color == red
+}
+
+//len returns the amount of counted values in a subtree, nil nodes being empty.
+func (n *mapNode[K, V]) len() int {
+	if n == nil {
+		return 0
+	}
+	return n.count
+}
+
+//own returns a node that can be modified in place: the node itself, unless it's older than the
+//last snapshot, in which case it returns a copy.
+//Every function below modifying nodes owns them first, which path-copies the nodes touched by
+//upsert() and delete() while leaving the nodes held by snapshots untouched.
+func (m *Map[K, V]) own(n *mapNode[K, V]) *mapNode[K, V] {
+	if n == nil || n.gen == m.gen {
+		return n
+	}
+	c := *n
+	c.gen = m.gen
+	return &c
+}
+
+//update recomputes the subtree count, and the aggregate if there's an Aggregator, from the childs.
+//It must be called on every node whose value or childs changed, bottom up.
+//Color flips don't change the subtree, so they need no update.
+func (m *Map[K, V]) update(n *mapNode[K, V]) {
+	n.count = n.left.len() + n.right.len()
+	if m.summary.counted == nil || m.summary.counted(n.value) {
+		n.count++
+	}
+	if a := m.summary.aggregator; a != nil {
+		n.agg = a.Combine(a.Combine(m.aggregate(n.left), m.summary.lift(n.value)), m.aggregate(n.right))
+	}
+}
+
+//aggregate returns the aggregate of a subtree, nil nodes being empty.
+func (m *Map[K, V]) aggregate(n *mapNode[K, V]) interface{} {
+	if n == nil {
+		return m.summary.aggregator.Identity()
+	}
+	return n.agg
+}
+
+//colorFlip inverts the colors on a node and it's childs
+func (m *Map[K, V]) colorFlip(n *mapNode[K, V]) *mapNode[K, V] {
+	n = m.own(n)
+	n.left = m.own(n.left)
+	n.right = m.own(n.right)
+	n.color = !n.color
+	n.left.color = !n.left.color
+	n.right.color = !n.right.color
+	return n
+}
+
+//rotateLeft does an anti-clockwise node rotation
+func (m *Map[K, V]) rotateLeft(n *mapNode[K, V]) *mapNode[K, V] {
+	n = m.own(n)
+	x := m.own(n.right)
+	n.right = x.left
+	x.left = n
+	x.color = n.color
+	n.color = red
+	m.update(n)
+	m.update(x)
+	return x
+}
+
+//rotateRight does a clockwise node rotation
+func (m *Map[K, V]) rotateRight(n *mapNode[K, V]) *mapNode[K, V] {
+	n = m.own(n)
+	x := m.own(n.left)
+	n.left = x.right
+	x.right = n
+	x.color = n.color
+	n.color = red
+	m.update(n)
+	m.update(x)
+	return x
+}
+
+//moveRedLeft makes sure n.left or one of its childs is red,
+//borrowing from the right sibling if needed.
+func (m *Map[K, V]) moveRedLeft(n *mapNode[K, V]) *mapNode[K, V] {
+	n = m.colorFlip(n)
+	if n.right.left.isRed() {
+		n.right = m.rotateRight(n.right)
+		n = m.rotateLeft(n)
+		n = m.colorFlip(n)
+	}
+	return n
+}
+
+//moveRedRight makes sure n.right or one of its childs is red,
+//borrowing from the left sibling if needed.
+func (m *Map[K, V]) moveRedRight(n *mapNode[K, V]) *mapNode[K, V] {
+	n = m.colorFlip(n)
+	if n.left.left.isRed() {
+		n = m.rotateRight(n)
+		n = m.colorFlip(n)
+	}
+	return n
+}
+
+//fixUp restores the left-leaning invariants on the way up.
+func (m *Map[K, V]) fixUp(n *mapNode[K, V]) *mapNode[K, V] {
+	n = m.own(n)
+	if n.right.isRed() && !n.left.isRed() {
+		n = m.rotateLeft(n)
+	}
+	if n.left.isRed() && n.left.left.isRed() {
+		n = m.rotateRight(n)
+	}
+	if n.left.isRed() && n.right.isRed() {
+		n = m.colorFlip(n)
+	}
+	m.update(n)
+	return n
+}
+
+//Len returns the amount of keys in the Map.
+func (m *Map[K, V]) Len() int {
+	return m.length
+}
+
+//Get searches for a given key and returns it's associated value
+//and a boolean indicating if it was found
+func (m *Map[K, V]) Get(key K) (v V, found bool) {
+	if node := m.find(key); node != nil {
+		return node.value, true
+	}
+	return v, false
+}
+
+//find returns the node holding key, or nil if there's none.
+func (m *Map[K, V]) find(key K) *mapNode[K, V] {
+	for node := m.root; node != nil; {
+		if cmp := m.cmp(node.key, key); cmp == 0 {
+			return node
+		} else if cmp < 0 {
+			node = node.right
+		} else {
+			node = node.left
+		}
+	}
+	return nil
+}
+
+//Put inserts a value identified by a key, replacing the previous value if the key existed.
+func (m *Map[K, V]) Put(key K, value V) {
+	m.upsert(key, func(V, bool) V { return value })
+}
+
+//upsert stores the value returned by value for key, which is given the current value, if found.
+func (m *Map[K, V]) upsert(key K, value func(old V, found bool) V) {
+	m.root = m.insert(m.root, key, value)
+	if m.root.isRed() {
+		m.root = m.own(m.root)
+		m.root.color = black
+	}
+}
+
+//insert does the left-leaning red black tree rotations and color flips.
+//Color flips are done on the way up, so the tree never holds 4-nodes (2-3 variant),
+//which is what delete() relies on.
+//It returns the new subtree root.
+func (m *Map[K, V]) insert(node *mapNode[K, V], key K, value func(V, bool) V) *mapNode[K, V] {
+	if node == nil {
+		var zero V
+		node := &mapNode[K, V]{key: key, value: value(zero, false), color: red, gen: m.gen}
+		m.update(node)
+		m.length++
+		return node
+	}
+	node = m.own(node)
+	if cmp := m.cmp(node.key, key); cmp == 0 {
+		node.value = value(node.value, true)
+	} else if cmp < 0 {
+		node.right = m.insert(node.right, key, value)
+	} else {
+		node.left = m.insert(node.left, key, value)
+	}
+	return m.fixUp(node)
+}
+
+//Delete removes a key and returns the value it held
+//and a boolean indicating if it was found.
+func (m *Map[K, V]) Delete(key K) (v V, found bool) {
+	var deleted *mapNode[K, V]
+	m.root, deleted = m.delete(m.root, key)
+	if m.root.isRed() {
+		m.root = m.own(m.root)
+		m.root.color = black
+	}
+	if deleted == nil {
+		return v, false
+	}
+	m.length--
+	return deleted.value, true
+}
+
+//delete does the left-leaning red black tree deletion, keeping a red link
+//on the way down so the removed node is never a black leaf.
+//It returns the new subtree root and the removed node, detached, as its key and value
+//may have been moved to another node.
+func (m *Map[K, V]) delete(node *mapNode[K, V], key K) (*mapNode[K, V], *mapNode[K, V]) {
+	var deleted *mapNode[K, V]
+	if node == nil {
+		return nil, nil
+	}
+	if m.cmp(node.key, key) > 0 {
+		if node.left == nil {
+			//key is not in the tree
+			return node, nil
+		}
+		node = m.own(node)
+		if !node.left.isRed() && !node.left.left.isRed() {
+			node = m.moveRedLeft(node)
+		}
+		node.left, deleted = m.delete(node.left, key)
+	} else {
+		node = m.own(node)
+		if node.left.isRed() {
+			node = m.rotateRight(node)
+		}
+		cmp := m.cmp(node.key, key)
+		if cmp == 0 && node.right == nil {
+			return nil, node
+		}
+		if node.right != nil && !node.right.isRed() && !node.right.left.isRed() {
+			node = m.moveRedRight(node)
+			cmp = m.cmp(node.key, key)
+		}
+		if cmp == 0 {
+			//replace the node contents with its successor and remove the successor instead
+			var successor *mapNode[K, V]
+			node.right, successor = m.deleteMin(node.right)
+			deleted = &mapNode[K, V]{key: node.key, value: node.value}
+			node.key, node.value = successor.key, successor.value
+		} else {
+			node.right, deleted = m.delete(node.right, key)
+		}
+	}
+	return m.fixUp(node), deleted
+}
+
+//deleteMin removes the left-most node from a subtree.
+//It returns the new subtree root and the removed node.
+func (m *Map[K, V]) deleteMin(node *mapNode[K, V]) (*mapNode[K, V], *mapNode[K, V]) {
+	var deleted *mapNode[K, V]
+	if node.left == nil {
+		return nil, node
+	}
+	node = m.own(node)
+	if !node.left.isRed() && !node.left.left.isRed() {
+		node = m.moveRedLeft(node)
+	}
+	node.left, deleted = m.deleteMin(node.left)
+	return m.fixUp(node), deleted
+}
+
+//Bound is an edge of a Map range. The zero Bound is unbounded.
+type Bound[K any] struct {
+	key     K
+	open    bool
+	bounded bool
+}
+
+//Including returns a Bound that includes key.
+func Including[K any](key K) Bound[K] {
+	return Bound[K]{key: key, bounded: true}
+}
+
+//Excluding returns a Bound that excludes key.
+func Excluding[K any](key K) Bound[K] {
+	return Bound[K]{key: key, open: true, bounded: true}
+}
+
+//after tells whether key is not before the bound, taken as a lower bound.
+func (m *Map[K, V]) after(key K, from Bound[K]) bool {
+	if !from.bounded {
+		return true
+	}
+	cmp := m.cmp(key, from.key)
+	return cmp > 0 || (cmp == 0 && !from.open)
+}
+
+//before tells whether key is not after the bound, taken as an upper bound.
+func (m *Map[K, V]) before(key K, to Bound[K]) bool {
+	if !to.bounded {
+		return true
+	}
+	cmp := m.cmp(key, to.key)
+	return cmp < 0 || (cmp == 0 && !to.open)
+}
+
+//countBefore returns the amount of counted values with keys lesser than key,
+//or lesser or equal if inclusive is set.
+func (m *Map[K, V]) countBefore(key K, inclusive bool) int {
+	count := 0
+	for node := m.root; node != nil; {
+		cmp := m.cmp(node.key, key)
+		if cmp < 0 || (cmp == 0 && inclusive) {
+			count += node.count - node.right.len()
+			node = node.right
+		} else {
+			node = node.left
+		}
+	}
+	return count
+}
+
+//at returns the node of the counted value at the given position in key order, starting at 0,
+//or nil if the position is out of range.
+func (m *Map[K, V]) at(position int) *mapNode[K, V] {
+	for node := m.root; node != nil && position >= 0; {
+		left := node.left.len()
+		if position < left {
+			node = node.left
+			continue
+		}
+		position -= left
+		if m.summary.counted == nil || m.summary.counted(node.value) {
+			if position == 0 {
+				return node
+			}
+			position--
+		}
+		node = node.right
+	}
+	return nil
+}
+
+//aggregateRange combines the values of a subtree between from and to. afterFrom and beforeTo
+//tell whether the whole subtree is known to be within the bounds.
+//Once the search paths for both bounds split, one side of every node is entirely within
+//the range and is answered by its stored aggregate, so only two paths are walked.
+func (m *Map[K, V]) aggregateRange(n *mapNode[K, V], from, to Bound[K], afterFrom, beforeTo bool) interface{} {
+	a := m.summary.aggregator
+	if n == nil {
+		return a.Identity()
+	}
+	if afterFrom && beforeTo {
+		return n.agg
+	}
+	if !afterFrom && !m.after(n.key, from) {
+		return m.aggregateRange(n.right, from, to, afterFrom, beforeTo)
+	}
+	if !beforeTo && !m.before(n.key, to) {
+		return m.aggregateRange(n.left, from, to, afterFrom, beforeTo)
+	}
+	left := m.aggregateRange(n.left, from, to, afterFrom, true)
+	right := m.aggregateRange(n.right, from, to, true, beforeTo)
+	return a.Combine(a.Combine(left, m.summary.lift(n.value)), right)
+}
+
+//resummarize recomputes the counts and aggregates of all the nodes, which is O(n).
+func (m *Map[K, V]) resummarize() {
+	var walk func(n *mapNode[K, V]) *mapNode[K, V]
+	walk = func(n *mapNode[K, V]) *mapNode[K, V] {
+		if n == nil {
+			return nil
+		}
+		n = m.own(n)
+		n.left = walk(n.left)
+		n.right = walk(n.right)
+		n.agg = nil
+		m.update(n)
+		return n
+	}
+	m.root = walk(m.root)
+}
+
+//MapIterator iterates over a range of a Map, walking the tree with a stack of the nodes left
+//to visit along with their right subtrees (left ones for reverse iterators).
+//It follows the smap.Iterator contract: Key() and Value() are only meaningful after Next()
+//or Seek() return true.
+type MapIterator[K, V any] struct {
+	m        *Map[K, V]
+	root     *mapNode[K, V]
+	stack    []*mapNode[K, V]
+	node     *mapNode[K, V]
+	from, to Bound[K]
+	reverse  bool
+}
+
+//Range returns an iterator over the keys between from and to, in order.
+func (m *Map[K, V]) Range(from, to Bound[K]) *MapIterator[K, V] {
+	return m.iterate(from, to, false, nil)
+}
+
+//RangeReverse returns an iterator over the keys between from and to, in reverse order.
+func (m *Map[K, V]) RangeReverse(from, to Bound[K]) *MapIterator[K, V] {
+	return m.iterate(from, to, true, nil)
+}
+
+//iterate builds an iterator, reusing stack if given.
+//The iterator keeps the current root, so it's not affected by later changes to a persistent tree.
+func (m *Map[K, V]) iterate(from, to Bound[K], reverse bool, stack []*mapNode[K, V]) *MapIterator[K, V] {
+	it := &MapIterator[K, V]{m: m, root: m.root, stack: stack[:0], from: from, to: to, reverse: reverse}
+	it.push(it.root, nil)
+	return it
+}
+
+//push walks down from node pushing the nodes that are within the starting bound, and seek if given.
+func (it *MapIterator[K, V]) push(node *mapNode[K, V], seek *K) {
+	for node != nil {
+		var within bool
+		if it.reverse {
+			within = it.m.before(node.key, it.to) && (seek == nil || it.m.cmp(node.key, *seek) <= 0)
+		} else {
+			within = it.m.after(node.key, it.from) && (seek == nil || it.m.cmp(node.key, *seek) >= 0)
+		}
+		if within {
+			it.stack = append(it.stack, node)
+			if it.reverse {
+				node = node.right
+			} else {
+				node = node.left
+			}
+		} else if it.reverse {
+			node = node.left
+		} else {
+			node = node.right
+		}
+	}
+}
+
+//Next advances the iterator one step.
+func (it *MapIterator[K, V]) Next() bool {
+	if len(it.stack) == 0 {
+		it.node = nil
+		return false
+	}
+	it.node = it.stack[len(it.stack)-1]
+	it.stack[len(it.stack)-1] = nil
+	it.stack = it.stack[:len(it.stack)-1]
+	if it.reverse {
+		for node := it.node.left; node != nil; node = node.right {
+			it.stack = append(it.stack, node)
+		}
+		if !it.m.after(it.node.key, it.from) {
+			it.clear()
+			return false
+		}
+	} else {
+		for node := it.node.right; node != nil; node = node.left {
+			it.stack = append(it.stack, node)
+		}
+		if !it.m.before(it.node.key, it.to) {
+			it.clear()
+			return false
+		}
+	}
+	return true
+}
+
+//clear empties the stack, keeping its capacity.
+func (it *MapIterator[K, V]) clear() {
+	clear(it.stack)
+	it.stack, it.node = it.stack[:0], nil
+}
+
+//Seek repositions the iterator at the first key >= key (<= key for reverse iterators)
+//within its range, like smap.SeekableIterator. The stack is reused.
+func (it *MapIterator[K, V]) Seek(key K) bool {
+	it.clear()
+	it.push(it.root, &key)
+	return it.Next()
+}
+
+//Key returns the current key in the iterator.
+func (it *MapIterator[K, V]) Key() K {
+	return it.node.key
+}
+
+//Value returns the current value in the iterator.
+func (it *MapIterator[K, V]) Value() V {
+	return it.node.value
+}
+
+//seq adapts an iterator to a range-over-func sequence.
+func (it *MapIterator[K, V]) seq(yield func(K, V) bool) {
+	for it.Next() {
+		if !yield(it.Key(), it.Value()) {
+			return
+		}
+	}
+}
+
+//All returns a sequence over all the keys and values in order.
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	return m.Between(Bound[K]{}, Bound[K]{})
+}
+
+//Between returns a sequence over the keys and values between from and to, in order.
+func (m *Map[K, V]) Between(from, to Bound[K]) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) { m.Range(from, to).seq(yield) }
+}
+
+//Backward returns a sequence over all the keys and values in reverse order.
+func (m *Map[K, V]) Backward() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) { m.RangeReverse(Bound[K]{}, Bound[K]{}).seq(yield) }
+}
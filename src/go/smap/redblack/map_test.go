@@ -0,0 +1,133 @@
+package redblack
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMapMatchesBuiltin(t *testing.T) {
+	m := NewMap[int, string]()
+	model := map[int]string{}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		k := r.Intn(300)
+		if r.Intn(3) == 0 {
+			expected, expectedFound := model[k]
+			if v, found := m.Delete(k); v != expected || found != expectedFound {
+				t.Fatalf("Expected to delete %q, %v for %d, got %q, %v", expected, expectedFound, k, v, found)
+			}
+			delete(model, k)
+		} else {
+			m.Put(k, fmt.Sprint(i))
+			model[k] = fmt.Sprint(i)
+		}
+		if !m.isBalanced() {
+			t.Fatalf("Map is not balanced after %d operations", i)
+		}
+	}
+	if m.Len() != len(model) {
+		t.Fatalf("Expected %d keys, got %d", len(model), m.Len())
+	}
+	keys := []int{}
+	for k := range model {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	i := 0
+	for k, v := range m.All() {
+		if k != keys[i] || v != model[k] {
+			t.Fatalf("Expected %d=%q, got %d=%q", keys[i], model[keys[i]], k, v)
+		}
+		i++
+	}
+	for k, v := range m.Backward() {
+		i--
+		if k != keys[i] || v != model[k] {
+			t.Fatalf("Expected %d=%q backwards, got %d=%q", keys[i], model[keys[i]], k, v)
+		}
+	}
+	for k := -1; k < 301; k++ {
+		expected, expectedFound := model[k]
+		if v, found := m.Get(k); v != expected || found != expectedFound {
+			t.Fatalf("Expected %q, %v for %d, got %q, %v", expected, expectedFound, k, v, found)
+		}
+	}
+}
+
+//collectKeys drains a MapIterator.
+func collectKeys(it *MapIterator[int, int]) []int {
+	keys := []int{}
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+	return keys
+}
+
+func TestMapRange(t *testing.T) {
+	m := NewMap[int, int]()
+	for k := 0; k < 100; k += 2 {
+		m.Put(k, k)
+	}
+	bounds := []Bound[int]{{}, Including(-5), Excluding(-5), Including(10), Excluding(10), Including(11), Excluding(11), Including(98), Excluding(98), Including(200)}
+	for _, from := range bounds {
+		for _, to := range bounds {
+			expected := []int{}
+			for k := 0; k < 100; k += 2 {
+				if m.after(k, from) && m.before(k, to) {
+					expected = append(expected, k)
+				}
+			}
+			if got := collectKeys(m.Range(from, to)); fmt.Sprint(got) != fmt.Sprint(expected) {
+				t.Fatalf("Range %v, %v: expected %v, got %v", from, to, expected, got)
+			}
+			sort.Sort(sort.Reverse(sort.IntSlice(expected)))
+			if got := collectKeys(m.RangeReverse(from, to)); fmt.Sprint(got) != fmt.Sprint(expected) {
+				t.Fatalf("RangeReverse %v, %v: expected %v, got %v", from, to, expected, got)
+			}
+		}
+	}
+}
+
+func TestMapSeek(t *testing.T) {
+	m := NewMap[int, int]()
+	for k := 0; k < 100; k += 2 {
+		m.Put(k, k)
+	}
+	it := m.Range(Including(10), Excluding(50))
+	if !it.Seek(31) || it.Key() != 32 {
+		t.Fatalf("Expected to seek to 32")
+	}
+	if !it.Seek(0) || it.Key() != 10 {
+		t.Fatalf("Expected seeking before the range to go back to its start")
+	}
+	if it.Seek(50) {
+		t.Fatalf("Expected seeking past the range to end the iteration, got %d", it.Key())
+	}
+	reverse := m.RangeReverse(Bound[int]{}, Bound[int]{})
+	if !reverse.Seek(31) || reverse.Key() != 30 || !reverse.Next() || reverse.Key() != 28 {
+		t.Fatalf("Expected reverse seek to go to 30 and then 28")
+	}
+}
+
+func TestMapFunc(t *testing.T) {
+	m := NewMapFunc[string, int](func(a, b string) int { return strings.Compare(strings.ToLower(a), strings.ToLower(b)) })
+	m.Put("Lemon", 1)
+	m.Put("lemon", 2)
+	m.Put("apple", 3)
+	if v, found := m.Get("LEMON"); !found || v != 2 || m.Len() != 2 {
+		t.Fatalf("Expected keys to be compared with the given function")
+	}
+	n := 0
+	for k := range m.Between(Including("b"), Bound[string]{}) {
+		if n++; k != "Lemon" {
+			t.Fatalf("Expected the first key to be kept, got %q", k)
+		}
+		break
+	}
+	if n != 1 {
+		t.Fatalf("Expected one key")
+	}
+}
@@ -0,0 +1,35 @@
+package redblack
+
+import (
+	"github.com/losmonos/stork/src/go/smap"
+)
+
+//Floor returns the greatest key <= key, along with its value. Empty entries are skipped.
+func (m *RedBlack) Floor(key smap.Key) (k smap.Key, v smap.Value, found bool) {
+	return smap.First(m.RangeReverse(smap.Interval{To: smap.Edge{Key: key}}))
+}
+
+//Ceiling returns the least key >= key, along with its value. Empty entries are skipped.
+func (m *RedBlack) Ceiling(key smap.Key) (k smap.Key, v smap.Value, found bool) {
+	return smap.First(m.Range(smap.Interval{From: smap.Edge{Key: key}}))
+}
+
+//Lower returns the greatest key < key, along with its value. Empty entries are skipped.
+func (m *RedBlack) Lower(key smap.Key) (k smap.Key, v smap.Value, found bool) {
+	return smap.First(m.RangeReverse(smap.Interval{To: smap.Edge{Key: key, Open: true}}))
+}
+
+//Higher returns the least key > key, along with its value. Empty entries are skipped.
+func (m *RedBlack) Higher(key smap.Key) (k smap.Key, v smap.Value, found bool) {
+	return smap.First(m.Range(smap.Interval{From: smap.Edge{Key: key, Open: true}}))
+}
+
+//Min returns the least key, along with its value. Empty entries are skipped.
+func (m *RedBlack) Min() (k smap.Key, v smap.Value, found bool) {
+	return smap.First(m.Range(smap.Interval{}))
+}
+
+//Max returns the greatest key, along with its value. Empty entries are skipped.
+func (m *RedBlack) Max() (k smap.Key, v smap.Value, found bool) {
+	return smap.First(m.RangeReverse(smap.Interval{}))
+}
@@ -0,0 +1,69 @@
+package redblack
+
+import (
+	"github.com/losmonos/stork/src/go/smap"
+	"math/rand"
+	"testing"
+)
+
+//expectEntry checks the result of a navigation method against the expected key, -1 meaning none.
+func expectEntry(t *testing.T, method string, key int, expected int, k smap.Key, v smap.Value, found bool) {
+	t.Helper()
+	if expected < 0 {
+		if found {
+			t.Fatalf("Expected %s(%d) to find nothing, got %v", method, key, k)
+		}
+	} else if !found || k != number(expected) || v != expected {
+		t.Fatalf("Expected %s(%d) to be %d, got %v, %v, %v", method, key, expected, k, v, found)
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	for _, m := range []*RedBlack{New(nnFactory), NewWithTombstones(nnFactory)} {
+		k, _, found := m.Min()
+		if found {
+			t.Fatalf("Expected an empty map to have no Min, got %v", k)
+		}
+		k, _, found = m.Max()
+		if found {
+			t.Fatalf("Expected an empty map to have no Max, got %v", k)
+		}
+		r := rand.New(rand.NewSource(1))
+		model := map[int]bool{}
+		for i := 0; i < 1000; i++ {
+			k := r.Intn(300)
+			if r.Intn(3) == 0 {
+				m.Delete(number(k))
+				delete(model, k)
+			} else {
+				m.Put(number(k), k)
+				model[k] = true
+			}
+		}
+		//closest finds the least or greatest key in the model satisfying ok, -1 meaning none
+		closest := func(greatest bool, ok func(k int) bool) int {
+			found := -1
+			for k := range model {
+				if ok(k) && (found < 0 || (k > found) == greatest) {
+					found = k
+				}
+			}
+			return found
+		}
+		for key := -1; key <= 300; key++ {
+			k, v, found := m.Floor(number(key))
+			expectEntry(t, "Floor", key, closest(true, func(k int) bool { return k <= key }), k, v, found)
+			k, v, found = m.Lower(number(key))
+			expectEntry(t, "Lower", key, closest(true, func(k int) bool { return k < key }), k, v, found)
+			k, v, found = m.Ceiling(number(key))
+			expectEntry(t, "Ceiling", key, closest(false, func(k int) bool { return k >= key }), k, v, found)
+			k, v, found = m.Higher(number(key))
+			expectEntry(t, "Higher", key, closest(false, func(k int) bool { return k > key }), k, v, found)
+		}
+		all := func(k int) bool { return true }
+		k, v, found := m.Min()
+		expectEntry(t, "Min", 0, closest(false, all), k, v, found)
+		k, v, found = m.Max()
+		expectEntry(t, "Max", 0, closest(true, all), k, v, found)
+	}
+}
@@ -0,0 +1,36 @@
+package redblack
+
+import (
+	"github.com/losmonos/stork/src/go/smap"
+)
+
+//Rank returns the amount of keys lesser than key, which is the position key has or would have
+//in a full scan. Empty entries are not counted. It runs in O(log n).
+func (m *RedBlack) Rank(key smap.Key) int {
+	return m.tree.countBefore(key, false)
+}
+
+//Select returns the key and value at the given position of a full scan, starting at 0.
+//found is false if the position is out of range. It runs in O(log n).
+func (m *RedBlack) Select(position int) (k smap.Key, v smap.Value, found bool) {
+	if node := m.tree.at(position); node != nil {
+		return node.key, node.value.GetValue(), true
+	}
+	return nil, nil, false
+}
+
+//CountInterval returns the amount of keys within the interval in O(log n), empty entries excluded.
+func (m *RedBlack) CountInterval(i smap.Interval) int {
+	to := m.Len()
+	if i.To != smap.Inf {
+		to = m.tree.countBefore(i.To.Key, !i.To.Open)
+	}
+	from := 0
+	if i.From != smap.Inf {
+		from = m.tree.countBefore(i.From.Key, i.From.Open)
+	}
+	if to < from {
+		return 0
+	}
+	return to - from
+}
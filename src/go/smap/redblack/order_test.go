@@ -0,0 +1,85 @@
+package redblack
+
+import (
+	"github.com/losmonos/stork/src/go/smap"
+	"math/rand"
+	"testing"
+)
+
+//checkCounts verifies the subtree counts of every node.
+func checkCounts(n *Node) bool {
+	if n == nil {
+		return true
+	}
+	expected := n.left.len() + n.right.len()
+	if !n.value.Empty() {
+		expected++
+	}
+	return n.count == expected && checkCounts(n.left) && checkCounts(n.right)
+}
+
+func TestOrderStatistics(t *testing.T) {
+	for _, m := range []*RedBlack{New(nnFactory), NewWithTombstones(nnFactory)} {
+		r := rand.New(rand.NewSource(1))
+		model := map[int]bool{}
+		for i := 0; i < 3000; i++ {
+			k := r.Intn(200)
+			if r.Intn(3) == 0 {
+				m.Delete(number(k))
+				delete(model, k)
+			} else {
+				m.Put(number(k), k)
+				model[k] = true
+			}
+			if !checkCounts(m.tree.root) {
+				t.Fatalf("Subtree counts are wrong after %d operations", i)
+			}
+		}
+		if m.tree.root.len() != m.Len() {
+			t.Fatalf("Expected the root count to be %d, got %d", m.Len(), m.tree.root.len())
+		}
+		live := []int{}
+		for k := 0; k < 200; k++ {
+			if model[k] {
+				live = append(live, k)
+			}
+		}
+		for k := -1; k <= 200; k++ {
+			expected := 0
+			for _, l := range live {
+				if l < k {
+					expected++
+				}
+			}
+			if got := m.Rank(number(k)); got != expected {
+				t.Fatalf("Expected rank %d for %d, got %d", expected, k, got)
+			}
+		}
+		for position := -1; position <= len(live); position++ {
+			k, v, found := m.Select(position)
+			if position < 0 || position == len(live) {
+				if found {
+					t.Fatalf("Expected nothing at %d, got %v", position, k)
+				}
+			} else if !found || k != number(live[position]) || v != live[position] {
+				t.Fatalf("Expected %d at %d, got %v, %v", live[position], position, k, found)
+			}
+		}
+		for n := 0; n < 500; n++ {
+			i := smap.Interval{}
+			if r.Intn(4) > 0 {
+				i.From = smap.Edge{Key: number(r.Intn(220) - 10), Open: r.Intn(2) == 0}
+			}
+			if r.Intn(4) > 0 {
+				i.To = smap.Edge{Key: number(r.Intn(220) - 10), Open: r.Intn(2) == 0}
+			}
+			expected := 0
+			for it := m.Range(i); it.Next(); {
+				expected++
+			}
+			if got := m.CountInterval(i); got != expected {
+				t.Fatalf("Expected %d keys in %v, got %d", expected, i, got)
+			}
+		}
+	}
+}
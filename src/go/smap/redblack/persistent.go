@@ -0,0 +1,126 @@
+package redblack
+
+import (
+	"github.com/losmonos/stork/src/go/smap"
+)
+
+//NewPersistent creates a new persistent RedBlack, which can hand out snapshots, see Snapshot().
+func NewPersistent(factory EntryFactory) *RedBlack {
+	return newRedBlack(factory, false, true)
+}
+
+//NewPersistentWithTombstones creates a new persistent RedBlack in tombstone mode.
+func NewPersistentWithTombstones(factory EntryFactory) *RedBlack {
+	return newRedBlack(factory, true, true)
+}
+
+//CopyableEntry is an Entry that can be copied.
+//Persistent RedBlacks never change entries in place, as snapshots may hold them:
+//Put() calls SetValue(v) on a copy of a CopyableEntry, other entries are replaced with new ones.
+type CopyableEntry interface {
+	Entry
+	Copy() Entry
+}
+
+//copyEntry returns a new entry holding value, built by copying old if possible.
+func copyEntry(old Entry, key smap.Key, value smap.Value, factory EntryFactory) Entry {
+	copyable, ok := old.(CopyableEntry)
+	if !ok {
+		return factory(key, value)
+	}
+	entry := copyable.Copy()
+	entry.SetValue(value)
+	return entry
+}
+
+//Snapshot is a read only view of a persistent RedBlack, as it was when it was taken.
+//It stays the same while the RedBlack keeps changing, and it can be read concurrently with it.
+type Snapshot struct {
+	m *RedBlack
+}
+
+//Snapshot returns a view of the current contents in O(1). It panics if the RedBlack is not persistent.
+//The snapshot holds the current nodes, so from then on Put() and Delete() copy the nodes they change
+//instead of changing them in place, just once per snapshot.
+func (m *RedBlack) Snapshot() *Snapshot {
+	if !m.persistent {
+		panic("Snapshot on a non persistent RedBlack")
+	}
+	frozen := *m
+	m.tree.gen++
+	return &Snapshot{&frozen}
+}
+
+//Get searches for a given key and returns it's associated value
+//and a boolean indicating if it was found.
+func (s *Snapshot) Get(key smap.Key) (v smap.Value, found bool) {
+	return s.m.Get(key)
+}
+
+//Lookup is like Get but it also finds empty entries (tombstones), reporting them as deleted.
+func (s *Snapshot) Lookup(key smap.Key) (v smap.Value, deleted, found bool) {
+	return s.m.Lookup(key)
+}
+
+//Range returns an Iterator over the snapshot entries within the interval, in order.
+func (s *Snapshot) Range(i smap.Interval) smap.Iterator {
+	return s.m.Range(i)
+}
+
+//RangeReverse returns an Iterator over the snapshot entries within the interval, in reverse order.
+func (s *Snapshot) RangeReverse(i smap.Interval) smap.Iterator {
+	return s.m.RangeReverse(i)
+}
+
+//RangeWithTombstones is like Range() but it also visits tombstones.
+func (s *Snapshot) RangeWithTombstones(i smap.Interval) smap.TombstoneIterator {
+	return s.m.RangeWithTombstones(i)
+}
+
+//RangeReverseWithTombstones is like RangeReverse() but it also visits tombstones.
+func (s *Snapshot) RangeReverseWithTombstones(i smap.Interval) smap.TombstoneIterator {
+	return s.m.RangeReverseWithTombstones(i)
+}
+
+//Floor returns the greatest key <= key, along with its value.
+func (s *Snapshot) Floor(key smap.Key) (k smap.Key, v smap.Value, found bool) {
+	return s.m.Floor(key)
+}
+
+//Ceiling returns the least key >= key, along with its value.
+func (s *Snapshot) Ceiling(key smap.Key) (k smap.Key, v smap.Value, found bool) {
+	return s.m.Ceiling(key)
+}
+
+//Lower returns the greatest key < key, along with its value.
+func (s *Snapshot) Lower(key smap.Key) (k smap.Key, v smap.Value, found bool) {
+	return s.m.Lower(key)
+}
+
+//Higher returns the least key > key, along with its value.
+func (s *Snapshot) Higher(key smap.Key) (k smap.Key, v smap.Value, found bool) {
+	return s.m.Higher(key)
+}
+
+//Min returns the least key, along with its value.
+func (s *Snapshot) Min() (k smap.Key, v smap.Value, found bool) {
+	return s.m.Min()
+}
+
+//Max returns the greatest key, along with its value.
+func (s *Snapshot) Max() (k smap.Key, v smap.Value, found bool) {
+	return s.m.Max()
+}
+
+//Len returns the amount of non empty entries in the snapshot.
+func (s *Snapshot) Len() int {
+	return s.m.Len()
+}
+
+//Size returns the size of the snapshot contents.
+func (s *Snapshot) Size() int {
+	return s.m.Size()
+}
+
+//enforce Snapshot implements SMapReader
+var _ smap.SMapReader = &Snapshot{}
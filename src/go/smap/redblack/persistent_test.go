@@ -0,0 +1,158 @@
+package redblack
+
+import (
+	"fmt"
+	"github.com/losmonos/stork/src/go/smap"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+//dump renders every entry visited by an iterator, tombstones included.
+func dump(it smap.TombstoneIterator) string {
+	s := ""
+	for it.Next() {
+		if it.Tombstone() {
+			s += fmt.Sprint(it.Key(), ":x ")
+		} else {
+			s += fmt.Sprint(it.Key(), ":", it.Value(), " ")
+		}
+	}
+	return s
+}
+
+func TestSnapshotsStayTheSame(t *testing.T) {
+	for _, m := range []*RedBlack{NewPersistent(nnFactory), NewPersistentWithTombstones(nnFactory)} {
+		m.SetAggregator(concat{})
+		r := rand.New(rand.NewSource(1))
+		snapshots := []*Snapshot{}
+		expected := []string{}
+		for i := 0; i < 3000; i++ {
+			k := number(r.Intn(200))
+			if r.Intn(3) == 0 {
+				m.Delete(k)
+			} else {
+				m.Put(k, i)
+			}
+			if i%100 == 0 {
+				snapshots = append(snapshots, m.Snapshot())
+				expected = append(expected, dump(m.RangeWithTombstones(smap.Interval{})))
+			}
+			if !m.isBalanced() || !checkCounts(m.tree.root) {
+				t.Fatalf("Broken invariants after %d operations", i)
+			}
+		}
+		for j, s := range snapshots {
+			if got := dump(s.RangeWithTombstones(smap.Interval{})); got != expected[j] {
+				t.Fatalf("Snapshot %d changed:\nexpected %s\ngot      %s", j, expected[j], got)
+			}
+			if !s.m.isBalanced() || !checkCounts(s.m.tree.root) {
+				t.Fatalf("Broken invariants in snapshot %d", j)
+			}
+			n := 0
+			for it := s.Range(smap.Interval{}); it.Next(); n++ {
+			}
+			if s.Len() != n {
+				t.Fatalf("Expected snapshot %d to hold %d keys, got %d", j, n, s.Len())
+			}
+		}
+		//the aggregates of the live tree must not be mixed up with those of the snapshots
+		all := ""
+		for it := m.Range(smap.Interval{}); it.Next(); {
+			all += fmt.Sprint(it.Value(), ",")
+		}
+		if got := m.Aggregate(smap.Interval{}); got != all {
+			t.Fatalf("Expected aggregate %s, got %s", all, got)
+		}
+	}
+}
+
+func TestSnapshotIsolatedFromPut(t *testing.T) {
+	m := NewPersistent(nnFactory)
+	m.Put(number(1), 1)
+	s := m.Snapshot()
+	m.Put(number(1), 2)
+	m.Put(number(2), 2)
+	if v, found := s.Get(number(1)); !found || v != 1 {
+		t.Errorf("Expected the snapshot to hold 1, got %v, %v", v, found)
+	}
+	if _, found := s.Get(number(2)); found {
+		t.Errorf("Expected the snapshot not to hold 2")
+	}
+	if v, _ := m.Get(number(1)); v != 2 {
+		t.Errorf("Expected the RedBlack to hold 2, got %v", v)
+	}
+}
+
+//list is a CopyableEntry collecting every value put on its key.
+type list struct {
+	key    number
+	values []int
+}
+
+func (e *list) GetKey() smap.Key { return e.key }
+
+func (e *list) GetValue() smap.Value { return e.values }
+
+func (e *list) SetValue(v smap.Value) { e.values = append(e.values, v.(int)) }
+
+func (e *list) Size() int { return 8 * len(e.values) }
+
+func (e *list) Empty() bool { return false }
+
+func (e *list) Copy() Entry { return &list{e.key, append([]int{}, e.values...)} }
+
+func listFactory(key smap.Key, value smap.Value) Entry {
+	return &list{key.(number), []int{value.(int)}}
+}
+
+func TestCopyableEntry(t *testing.T) {
+	m := NewPersistent(listFactory)
+	m.Put(number(1), 1)
+	s := m.Snapshot()
+	m.Put(number(1), 2)
+	if v, _ := s.Get(number(1)); fmt.Sprint(v) != "[1]" {
+		t.Errorf("Expected the snapshot to hold [1], got %v", v)
+	}
+	if v, _ := m.Get(number(1)); fmt.Sprint(v) != "[1 2]" {
+		t.Errorf("Expected the RedBlack to hold [1 2], got %v", v)
+	}
+}
+
+func TestSnapshotOnNonPersistent(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected Snapshot to panic")
+		}
+	}()
+	New(nnFactory).Snapshot()
+}
+
+func TestReadSnapshotWhileWriting(t *testing.T) {
+	m := NewPersistent(nnFactory)
+	for k := 0; k < 1000; k++ {
+		m.Put(number(k), k)
+	}
+	s := m.Snapshot()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for k := 0; k < 1000; k++ {
+			m.Delete(number(k))
+			m.Put(number(k+1000), k)
+		}
+	}()
+	for round := 0; round < 5; round++ {
+		k := 0
+		for it := s.Range(smap.Interval{}); it.Next(); k++ {
+			if it.Key() != number(k) || it.Value() != k {
+				t.Fatalf("Expected %d in the snapshot, got %v", k, it.Key())
+			}
+		}
+		if k != 1000 {
+			t.Fatalf("Expected 1000 keys in the snapshot, got %d", k)
+		}
+	}
+	wg.Wait()
+}
@@ -15,69 +15,57 @@ type Entry interface {
 //EntryFactory builds an entry given a Key and a Value
 type EntryFactory func(smap.Key, smap.Value) Entry
 
-//A Node is the main element in the RedBlack structure.
-//It holds an entry, links to its childs and the red/black color
-type Node struct {
-	entry       Entry
-	Left, Right *Node
-	Color       bool
-}
-
-//XXX constants should be upper case, but what about unexported constants?
-const (
-	red   = false
-	black = true
-)
+//A Node is the main element in the RedBlack structure: a Map node holding an Entry.
+type Node = mapNode[smap.Key, Entry]
 
-//RedBlack implements a sorted Map
+//RedBlack implements a sorted Map of Entries, on top of a Map keyed by smap.Key.
+//The tree counts the non empty entries only, so its counts and Len() skip tombstones.
+//bytes is the total Size() of the entries.
 type RedBlack struct {
-	root    *Node
-	factory EntryFactory
-	length  int
-	bytes   int
+	tree       Map[smap.Key, Entry]
+	factory    EntryFactory
+	bytes      int
+	tombstones bool
+	persistent bool
 }
 
 //New creates a new RedBlack
 func New(factory EntryFactory) *RedBlack {
-	return &RedBlack{factory: factory}
+	return newRedBlack(factory, false, false)
 }
 
-//isRed returns whether the node is red (or black). Nil nodes (empty leafs) are black
-func (n *Node) isRed() bool {
-	return n != nil && n.Color == red
+//NewWithTombstones creates a new RedBlack in tombstone mode:
+//Delete() keeps the deleted keys around as empty entries instead of removing them.
+func NewWithTombstones(factory EntryFactory) *RedBlack {
+	return newRedBlack(factory, true, false)
 }
 
-//colorFlip inverts the colors on a node and it's childs
-func (n *Node) colorFlip() {
-	n.Color = !n.Color
-	n.Left.Color = !n.Left.Color
-	n.Right.Color = !n.Right.Color
+//newRedBlack builds an empty RedBlack.
+func newRedBlack(factory EntryFactory, tombstones, persistent bool) *RedBlack {
+	m := &RedBlack{factory: factory, tombstones: tombstones, persistent: persistent}
+	m.tree.cmp = compareKeys
+	m.tree.summary.counted = nonEmpty
+	return m
 }
 
-//rotateLeft does an anti-clockwise node rotation
-func (n *Node) rotateLeft() *Node {
-	x := n.Right
-	n.Right = x.Left
-	x.Left = n
-	x.Color = n.Color
-	n.Color = red
-	return x
-
+//compareKeys orders the tree by smap.Key.Cmp.
+func compareKeys(a, b smap.Key) int {
+	return a.Cmp(b)
 }
 
-//rotateRight does a clockwise node rotation
-func (n *Node) rotateRight() *Node {
-	x := n.Left
-	n.Left = x.Right
-	x.Right = n
-	x.Color = n.Color
-	n.Color = red
-	return x
+//nonEmpty tells whether an entry is counted by the tree.
+func nonEmpty(e Entry) bool {
+	return !e.Empty()
 }
 
 //Len returns the amount of non empty nodes in a RedBlack
 func (m *RedBlack) Len() int {
-	return m.length
+	return m.tree.root.len()
+}
+
+//Nodes returns the amount of nodes in a RedBlack, empty ones (tombstones) included.
+func (m *RedBlack) Nodes() int {
+	return m.tree.Len()
 }
 
 //Size returns the size of the RedBlack contents
@@ -86,61 +74,70 @@ func (m *RedBlack) Size() int {
 }
 
 //Get searches for a given key and returns it's associated value
-//and a boolean indicating if it was found
+//and a boolean indicating if it was found. Empty entries are reported as not found.
 func (m *RedBlack) Get(key smap.Key) (v smap.Value, found bool) {
-	for current := m.root; current != nil; {
-		if cmp := current.entry.GetKey().Cmp(key); cmp == 0 {
-			return current.entry.GetValue(), true
-		} else if cmp > 0 {
-			current = current.Left
-		} else if cmp < 0 {
-			current = current.Right
-		}
+	if node := m.tree.find(key); node != nil && !node.value.Empty() {
+		return node.value.GetValue(), true
 	}
 	return nil, false
 }
 
+//Lookup is like Get but it also finds empty entries (tombstones), reporting them as deleted.
+func (m *RedBlack) Lookup(key smap.Key) (v smap.Value, deleted, found bool) {
+	node := m.tree.find(key)
+	if node == nil {
+		return nil, false, false
+	}
+	if node.value.Empty() {
+		return nil, true, true
+	}
+	return node.value.GetValue(), false, true
+}
+
 //Put inserts a value identified by a key. if the key already existed,
 //Entry.SetValue(v) will be called on the already occupied slot.
 //It's up to Entry implementation to define whether the value is replaced
-//or some other action is taken. It may be possible to build a multi-map
-//by having Entry store the values in a collection.
-//Note that this may lead to a more complicate semantic of delete() which
-//is not yet implemented.
+//or some other action is taken. A multi-map can be built by having Entry
+//store the values in a collection, as entries.Multi does.
+//Note that Delete() removes the whole slot, regardless of how many values
+//the Entry holds. Putting on an empty entry replaces it with a new one.
 func (m *RedBlack) Put(key smap.Key, value smap.Value) {
-	m.root = m.insert(m.root, key, value)
-	m.root.Color = black
+	m.tree.upsert(key, func(old Entry, found bool) Entry {
+		if !found {
+			entry := m.factory(key, value)
+			m.bytes += entry.Size()
+			return entry
+		}
+		m.bytes -= old.Size()
+		entry := old
+		if old.Empty() {
+			entry = m.factory(key, value)
+		} else if m.persistent {
+			entry = copyEntry(old, key, value, m.factory)
+		} else {
+			entry.SetValue(value)
+		}
+		m.bytes += entry.Size()
+		return entry
+	})
 }
 
-//insert does the left-leaning red black tree rotations and color flips.
-//It returns the new tree root.
-func (m *RedBlack) insert(node *Node, key smap.Key, value smap.Value) *Node {
-	if node == nil {
-		entry := m.factory(key, value)
-		node := &Node{entry, nil, nil, red}
-		m.length++
-		m.bytes += entry.Size()
-		return node
-	}
-	if node.Left.isRed() && node.Right.isRed() {
-		node.colorFlip()
-	}
-	if cmp := node.entry.GetKey().Cmp(key); cmp == 0 {
-		m.bytes -= node.entry.Size()
-		node.entry.SetValue(value)
-		m.bytes += node.entry.Size()
-	} else if cmp < 0 {
-		node.Right = m.insert(node.Right, key, value)
-	} else if cmp > 0 {
-		node.Left = m.insert(node.Left, key, value)
+//Delete removes a key and returns the value it held
+//and a boolean indicating if it was found.
+//In tombstone mode the key is kept with an empty entry, see bury().
+func (m *RedBlack) Delete(key smap.Key) (v smap.Value, found bool) {
+	if m.tombstones {
+		return m.bury(key)
 	}
-	if node.Right.isRed() && !node.Left.isRed() {
-		node = node.rotateLeft()
+	deleted, found := m.tree.Delete(key)
+	if !found {
+		return nil, false
 	}
-	if node.Left.isRed() && node.Left.Left.isRed() {
-		node = node.rotateRight()
+	m.bytes -= deleted.Size()
+	if deleted.Empty() {
+		return nil, false
 	}
-	return node
+	return deleted.GetValue(), true
 }
 
 //enforce redblack implements smap
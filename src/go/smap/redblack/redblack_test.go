@@ -25,9 +25,9 @@ func checkOrderInvariant(s smap.SMap, t *testing.T) {
 	m := s.(*RedBlack)
 	last := str("")
 	m.inOrder(func(n *Node) bool {
-		current := n.entry.GetKey()
+		current := n.value.GetKey()
 		if current.Cmp(last) < 0 {
-			t.Errorf("Expected %s to be less than %s", last, n.entry.GetKey())
+			t.Errorf("Expected %s to be less than %s", last, n.value.GetKey())
 		}
 		last = current.(str)
 		return true
@@ -48,7 +48,7 @@ func isOrdered(s smap.SMap) bool {
 	last := str("")
 	holds := true
 	m.inOrder(func(n *Node) bool {
-		current := n.entry.GetKey()
+		current := n.value.GetKey()
 		if current.Cmp(last) < 0 {
 			holds = false
 			return false
@@ -74,8 +74,8 @@ func gotRight(s smap.SMap) bool {
 	m := s.(*RedBlack)
 	holds := true
 	m.inOrder(func(n *Node) bool {
-		v, found := m.Get(n.entry.GetKey())
-		holds = found && v == n.entry.GetValue()
+		v, found := m.Get(n.value.GetKey())
+		holds = found && v == n.value.GetValue()
 		return holds
 	})
 	return holds
@@ -174,3 +174,74 @@ func loadStringLines(filename string) []string {
 	}
 	return lines
 }
+
+func TestDelete(t *testing.T) {
+	store := sstore{New(ssFactory)}
+	for _, word := range shortWordList {
+		store.Put(word, word)
+	}
+	if v, found := store.SMap.Delete(str("cherry")); !found || v != "cherry" {
+		t.Fatalf("Expected to delete 'cherry', got %q, %v", v, found)
+	}
+	if v, found := store.Get("cherry"); found {
+		t.Fatalf("Expected 'cherry' to be deleted, got %q", v)
+	}
+	if v, found := store.SMap.Delete(str("cherry")); found {
+		t.Fatalf("Expected second delete to find nothing, got %q", v)
+	}
+	if v, found := store.SMap.Delete(str("apple")); found {
+		t.Fatalf("Expected missing key delete to find nothing, got %q", v)
+	}
+	if expected := len(shortWordList) - 1; store.Len() != expected {
+		t.Fatalf("Expected length %d, got %d", expected, store.Len())
+	}
+	if expected := len("blueberry") + len("lemon") + len("orange"); store.SMap.Size() != 2*expected {
+		t.Fatalf("Expected size %d, got %d", 2*expected, store.SMap.Size())
+	}
+}
+
+func TestDeleteAll(t *testing.T) {
+	testData.load()
+	words := testData.shuffled_words[:5000]
+	m := getLoadedStore(words)
+	for i, word := range words {
+		if v, found := m.Delete(str(word)); !found || v != word {
+			t.Fatalf("Expected to delete '%s', got %q, %v", word, v, found)
+		}
+		if expected := len(words) - i - 1; m.Len() != expected {
+			t.Fatalf("Expected length %d, got %d", expected, m.Len())
+		}
+		if i%100 == 0 && !m.isBalanced() {
+			t.Fatalf("Tree unbalanced after deleting '%s'", word)
+		}
+	}
+	if m.Size() != 0 {
+		t.Fatalf("Expected empty tree to have size 0, got %d", m.Size())
+	}
+	if scan := m.Range(smap.Interval{}); scan.Next() {
+		t.Fatalf("Expected empty scan after deleting all keys, got %q", scan.Value())
+	}
+}
+
+func TestDeleteKeepsOrder(t *testing.T) {
+	m := New(nnFactory)
+	f := func(put, del uint8) bool {
+		m.Put(number(put), int(put))
+		m.Delete(number(del))
+		if _, found := m.Get(number(del)); found {
+			return false
+		}
+		last, count := -1, 0
+		for scan := m.Range(smap.Interval{}); scan.Next(); count++ {
+			if current := int(scan.Key().(number)); current <= last {
+				return false
+			} else {
+				last = current
+			}
+		}
+		return count == m.Len() && m.isBalanced()
+	}
+	if err := quick.Check(f, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
@@ -2,227 +2,169 @@ package redblack
 
 import (
 	"github.com/losmonos/stork/src/go/smap"
-	"math"
+	"iter"
+	"sync"
 )
 
-//fixedNodeStack is a simple fixed size stack of *Node, used in iterative tree traversals.
-type fixedNodeStack struct {
-	nodes []*Node
-	next  int
-}
-
-//Push pushes one node on top of the stack
-func (stack *fixedNodeStack) Push(node *Node) {
-	stack.nodes[stack.next] = node
-	stack.next++
+//Scanner adapts a MapIterator over the RedBlack nodes to smap.Iterator.
+//Empty entries are skipped unless the scanner was built to visit tombstones.
+//It implements smap.TombstoneIterator and smap.SeekableIterator.
+type Scanner struct {
+	it         *MapIterator[smap.Key, Entry]
+	tombstones bool
 }
 
-//Pop removes the topmost node and returns it
-func (stack *fixedNodeStack) Pop() *Node {
-	stack.next--
-	node := stack.nodes[stack.next]
-	stack.nodes[stack.next] = nil
-	return node
+//bound converts an interval edge to a Bound, smap.Inf being unbounded.
+func bound(e smap.Edge) Bound[smap.Key] {
+	if e == smap.Inf {
+		return Bound[smap.Key]{}
+	}
+	return Bound[smap.Key]{key: e.Key, open: e.Open, bounded: true}
 }
 
-//Peek returns the topmost node without removing it.
-func (stack *fixedNodeStack) Peek() *Node {
-	return stack.nodes[stack.next-1]
+//stackPool keeps the stacks of closed scanners.
+var stackPool sync.Pool
 
+//scan builds the Scanner for an interval, reusing a pooled stack if there's one.
+func (m *RedBlack) scan(i smap.Interval, reverse, tombstones bool) *Scanner {
+	var stack []*Node
+	if pooled, ok := stackPool.Get().(*[]*Node); ok {
+		stack = *pooled
+	}
+	return &Scanner{it: m.tree.iterate(bound(i.From), bound(i.To), reverse, stack), tombstones: tombstones}
 }
 
-//Empty tells whether there are no more nodes in the stack.
-func (stack *fixedNodeStack) Empty() bool {
-	return stack.next == 0
+//Next advances the iterator one step and if returns true, an entry will be available upon calling Key() and Value()
+func (s *Scanner) Next() bool {
+	for s.it != nil && s.it.Next() {
+		if s.visible() {
+			return true
+		}
+	}
+	return false
 }
 
-//maxHeight returns the maximum possible tree height as long as no new nodes are added to it.
-func (m *RedBlack) maxHeight() int {
-	return 2 * int(math.Ceil(math.Log2(float64(m.Len()))))
+//visible tells whether the current node should be yielded by the scanner.
+func (s *Scanner) visible() bool {
+	return s.tombstones || !s.it.Value().Empty()
 }
 
-//Scanner iterates over all the nodes initially pushed onto its stack along with their right subtrees
-//The order of iteration is: root (the node in the stack), then in-order iteration of the node's right subtree
-//If the stack is populated with the leftmost walk of a binary tree,
-//then this implements an in-order full scan iterator
-//It is meant to fullfill both a full scan and a scan starting from a given value.
-type Scanner struct {
-	stack *fixedNodeStack
-	node  *Node
+//Seek repositions the scanner on the first visible node at or after key, see smap.SeekableIterator.
+//It never moves before the start of the scanned interval, nor past its end.
+//The stack is reused, so it is O(log n) and doesn't allocate.
+func (s *Scanner) Seek(key smap.Key) bool {
+	return s.it != nil && s.it.Seek(key) && (s.visible() || s.Next())
 }
 
-type EmptyScanner struct{}
-
-func (s EmptyScanner) Next() bool {
-	return false
-}
-func (s EmptyScanner) Value() smap.Value {
-	panic("Empty Scanner")
-}
-func (s EmptyScanner) Key() smap.Key {
-	panic("Empty Scanner")
+//Close ends the iteration and hands the scanner stack back for reuse.
+//It's optional, but it saves allocations when scans are frequent and not always drained.
+func (s *Scanner) Close() error {
+	if s.it != nil {
+		s.it.clear()
+		stack := s.it.stack
+		stackPool.Put(&stack)
+		s.it = nil
+	}
+	return nil
 }
 
-//Next advances the iterator one step and if returns true, an entry will be available upon calling Entry()
-func (s *Scanner) Next() bool {
-	stack := s.stack
-	if stack.Empty() {
-		return false
-	}
-	s.node = stack.Pop()
-	for node := s.node.Right; node != nil; node = node.Left {
-		stack.Push(node)
-	}
-	return true
+//Tombstone tells whether the current entry is empty, which only happens
+//on scanners that visit tombstones.
+func (s *Scanner) Tombstone() bool {
+	return s.it.Value().Empty()
 }
 
 //Value returns the current value in the iterator.
 func (s *Scanner) Value() smap.Value {
-	return s.node.entry.GetValue()
+	return s.it.Value().GetValue()
 }
 
 //Key returns the current key in the iterator.
 func (s *Scanner) Key() smap.Key {
-	return s.node.entry.GetKey()
+	return s.it.Key()
 }
 
-//Scan() returns an Iterator that iterates over the tree elements in order within the given interval
+//Range returns an Iterator that iterates over the tree elements in order within the given interval
+//Empty entries (tombstones) are skipped.
 func (m *RedBlack) Range(i smap.Interval) smap.Iterator {
-	if i.From == smap.Inf && i.To == smap.Inf {
-		return m.fullScan()
-	} else if i.To == smap.Inf {
-		return m.upToScan(i.To)
-	} else if i.From == smap.Inf {
-		return m.fromScan(i.From)
-	} else {
-		if i.From.Key.Cmp(i.To.Key) > 0 {
-			return EmptyScanner{}
-		} else {
-			return m.rangeScan(i.From, i.To)
-		}
-	}
+	return m.scan(i, false, false)
 }
 
-//upToScanner implements a scanner with a max boundary.
-type upToScanner struct {
-	*Scanner
-	boundary     *Node
-	hit_boundary bool
+//RangeWithTombstones is like Range() but it also visits empty entries.
+//The returned iterator implements smap.TombstoneIterator.
+func (m *RedBlack) RangeWithTombstones(i smap.Interval) smap.TombstoneIterator {
+	return m.scan(i, false, true)
 }
 
-//Next advances the iterator one step and if returns true, an entry will be available upon calling Entry()
-func (u *upToScanner) Next() bool {
-	if u.hit_boundary || !u.Scanner.Next() {
-		return false
-	} else {
-		if u.Scanner.node == u.boundary {
-			u.hit_boundary = true
-		}
-		return true
-	}
+//RangeReverse returns an Iterator that iterates over the tree elements in reverse order within the given interval
+//Empty entries (tombstones) are skipped.
+func (m *RedBlack) RangeReverse(i smap.Interval) smap.Iterator {
+	return m.scan(i, true, false)
 }
 
-//FromScan returns an iterator that scans through the RedBlack keys in order starting at the specified edge.
-func (m *RedBlack) fromScan(from smap.Edge) smap.Iterator {
-	stack := m.buildLeftBoundStack(from)
-	return &Scanner{stack: stack}
+//RangeReverseWithTombstones is like RangeReverse() but it also visits empty entries.
+//The returned iterator implements smap.TombstoneIterator.
+func (m *RedBlack) RangeReverseWithTombstones(i smap.Interval) smap.TombstoneIterator {
+	return m.scan(i, true, true)
 }
 
-//FullScan returns an iterator that scans through all the RedBlack keys in order
-func (m *RedBlack) fullScan() smap.Iterator {
-	stack := m.makeHeightStack()
-	//populate the stack with all the left wing roots
-	for node := m.root; node != nil; node = node.Left {
-		stack.Push(node)
-	}
-	return &Scanner{stack: stack}
+//prefixScanner stops a scan at the first key that doesn't start with the prefix.
+type prefixScanner struct {
+	smap.TombstoneIterator
+	prefix smap.PrefixKey
+	done   bool
 }
 
-//FromScan returns an iterator that scans through the RedBlack keys in order stopping at the specified edge.
-func (m *RedBlack) upToScan(to smap.Edge) smap.Iterator {
-	boundary := m.getRightBound(to)
-	if boundary == nil {
-		return EmptyScanner{}
-	} else {
-		scanner := m.fullScan().(*Scanner)
-		return &upToScanner{scanner, boundary, false}
+//Next advances the iterator one step, ending the iteration once the prefix stops matching.
+func (p *prefixScanner) Next() bool {
+	if p.done || !p.TombstoneIterator.Next() || !p.prefix.IsPrefixOf(p.Key()) {
+		p.done = true
+		return false
 	}
+	return true
 }
 
-//RangeScan returns an iterator that scans through the RedBlack keys in order between the given start and end edges.
-func (m *RedBlack) rangeScan(from, to smap.Edge) smap.Iterator {
-	boundary := m.getRightBound(to)
-	if boundary == nil {
-		return EmptyScanner{}
-	}
-	scanner := m.fromScan(from).(*Scanner)
-	//abort if scanner stack is empty, further checks need a non-empty stack.
-	if scanner.stack.Empty() {
-		return EmptyScanner{}
+//Seek repositions the scanner, see smap.SeekableIterator. Seeking past the prefix ends the iteration.
+func (p *prefixScanner) Seek(key smap.Key) bool {
+	p.done = false
+	if !p.TombstoneIterator.(smap.SeekableIterator).Seek(key) || !p.prefix.IsPrefixOf(p.Key()) {
+		p.done = true
+		return false
 	}
-	rightKey := boundary.entry.GetKey()
-	leftKey := scanner.stack.Peek().entry.GetKey()
-	if leftKey.Cmp(rightKey) > 0 {
-		return EmptyScanner{}
+	return true
+}
+
+//Close ends the iteration, see Scanner.Close().
+func (p *prefixScanner) Close() error {
+	p.done = true
+	if closer, ok := p.TombstoneIterator.(interface{ Close() error }); ok {
+		return closer.Close()
 	}
-	return &upToScanner{scanner, boundary, false}
-}
-
-//allocate a stack suitable for traversing the tree.
-func (m *RedBlack) makeHeightStack() *fixedNodeStack {
-	return &fixedNodeStack{make([]*Node, m.maxHeight()), 0}
-}
-
-//build a stack with the left-most list of disjoint sub-trees that together will satisfy:
-//a Scanner will traverse the nodes in order.
-//the Scanner will visit all (and only) the nodes which keys are >= left edge
-func (m *RedBlack) buildLeftBoundStack(left smap.Edge) *fixedNodeStack {
-	stack := m.makeHeightStack()
-	key := left.Key
-	for current := m.root; current != nil; {
-		if cmp := current.entry.GetKey().Cmp(key); cmp == 0 {
-			if left.Open {
-				for current = current.Right; current != nil; current = current.Left {
-					stack.Push(current)
-				}
-			} else {
-				stack.Push(current)
-			}
-			break
-		} else if cmp > 0 {
-			stack.Push(current)
-			current = current.Left
-		} else if cmp < 0 {
-			current = current.Right
-		}
+	return nil
+}
+
+//PrefixRange returns an Iterator over the keys starting with prefix, in order.
+//It only relies on IsPrefixOf() to end the scan. Empty entries (tombstones) are skipped.
+func (m *RedBlack) PrefixRange(prefix smap.PrefixKey) smap.Iterator {
+	return &prefixScanner{TombstoneIterator: m.scan(smap.Interval{From: smap.Edge{Key: prefix}}, false, false), prefix: prefix}
+}
+
+//All returns a sequence over all the keys and values in order, tombstones excluded.
+//Breaking out of the loop releases the underlying scanner.
+func (m *RedBlack) All() iter.Seq2[smap.Key, smap.Value] {
+	return m.Between(smap.Interval{})
+}
+
+//Between returns a sequence over the keys and values within the interval, in order.
+func (m *RedBlack) Between(i smap.Interval) iter.Seq2[smap.Key, smap.Value] {
+	return func(yield func(smap.Key, smap.Value) bool) {
+		smap.All(m.Range(i))(yield)
 	}
-	return stack
-}
-
-//find the right boundary in the RedBlack given a right edge.
-//The returning node will have the greater key
-//such that node.Key <= right.Key (< for open edge).
-//If returns nil, it means the right edge is less than all the keys in the tree
-//The edge key does not need to be in the RedBlack
-func (m *RedBlack) getRightBound(right smap.Edge) *Node {
-	var last *Node = nil
-	key := right.Key
-	for current := m.root; current != nil; {
-		if cmp := current.entry.GetKey().Cmp(key); cmp == 0 {
-			if right.Open {
-				for current = current.Left; current != nil; current = current.Right {
-					last = current
-				}
-				return last
-			} else {
-				return current
-			}
-		} else if cmp > 0 {
-			current = current.Left
-		} else if cmp < 0 {
-			last = current
-			current = current.Right
-		}
+}
+
+//Backward returns a sequence over all the keys and values in reverse order.
+func (m *RedBlack) Backward() iter.Seq2[smap.Key, smap.Value] {
+	return func(yield func(smap.Key, smap.Value) bool) {
+		smap.All(m.RangeReverse(smap.Interval{}))(yield)
 	}
-	return last
 }
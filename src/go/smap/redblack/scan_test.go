@@ -1,9 +1,12 @@
 package redblack
 
 import (
+	"fmt"
 	"github.com/losmonos/stork/src/go/smap"
 	"sort"
+	"strings"
 	"testing"
+	"testing/quick"
 )
 
 func getLoadedStore(words []string) *RedBlack {
@@ -147,6 +150,32 @@ func TestOpenInterval(t *testing.T) {
 	}
 }
 
+//TestHalfOpenRanges covers the intervals with a single infinite edge,
+//which used to be dispatched to the scan of the opposite edge.
+func TestHalfOpenRanges(t *testing.T) {
+	store := getLoadedStore(shortWordList)
+	cases := []struct {
+		i        smap.Interval
+		expected string
+	}{
+		{smap.Interval{From: smap.Edge{Key: str("cherry")}}, "cherry lemon orange"},
+		{smap.Interval{From: smap.Edge{Key: str("cherry"), Open: true}}, "lemon orange"},
+		{smap.Interval{From: smap.Edge{Key: str("pear")}}, ""},
+		{smap.Interval{To: smap.Edge{Key: str("lemon")}}, "blueberry cherry lemon"},
+		{smap.Interval{To: smap.Edge{Key: str("lemon"), Open: true}}, "blueberry cherry"},
+		{smap.Interval{To: smap.Edge{Key: str("apple")}}, ""},
+	}
+	for _, c := range cases {
+		got := []string{}
+		for scan := store.Range(c.i); scan.Next(); {
+			got = append(got, scan.Value().(string))
+		}
+		if strings.Join(got, " ") != c.expected {
+			t.Fatalf("Expected %q for %v, got %q", c.expected, c.i, got)
+		}
+	}
+}
+
 func TestInvertedInterval(t *testing.T) {
 	store := getLoadedStore(shortWordList)
 	msg := "Inverted Interval returned non empty results, got %q"
@@ -163,3 +192,285 @@ func TestInvertedInterval(t *testing.T) {
 		t.Fatalf(msg, scan.Value())
 	}
 }
+
+func TestSingleFullScan(t *testing.T) {
+	store := getLoadedStore([]string{"lemon"})
+	scan := store.Range(smap.Interval{})
+	if !scan.Next() || scan.Value() != "lemon" {
+		t.Fatalf("Expected 'lemon' in single element scan")
+	}
+	if scan.Next() {
+		t.Fatalf("Expected end of iteration, got %q", scan.Value())
+	}
+}
+
+func TestRangeAfterDelete(t *testing.T) {
+	store := getLoadedStore(shortWordList)
+	store.Delete(str("lemon"))
+	scan := store.Range(wordInterval("blueberry", "orange", false, false))
+	for _, expect := range []string{"blueberry", "cherry", "orange"} {
+		if !scan.Next() {
+			t.Fatalf("Expected '%s', got nothing instead", expect)
+		} else if got := scan.Value(); got != expect {
+			t.Fatalf("Expected '%s', got '%s' instead", expect, got)
+		}
+	}
+	if scan.Next() {
+		t.Fatalf("Expected end of iteration, got %q instead", scan.Value())
+	}
+}
+
+func TestFullReverseScan(t *testing.T) {
+	testData.load()
+	store := getLoadedStore(testData.words)
+	i := len(testData.words) - 1
+	for scanner := store.RangeReverse(smap.Interval{}); scanner.Next(); i-- {
+		if scanner_word, word := scanner.Value().(string), testData.words[i]; scanner_word != word {
+			t.Fatalf("Expected '%s' in reverse FullScan, got '%s' instead'", word, scanner_word)
+		}
+	}
+	if i != -1 {
+		t.Fatalf("Reverse FullScan stopped at [%d]='%s'", i, testData.words[i])
+	}
+}
+
+func TestReverseOpenInterval(t *testing.T) {
+	store := getLoadedStore(shortWordList)
+	scan := store.RangeReverse(wordInterval("blueberry", "orange", true, true))
+	for _, expect := range []string{"lemon", "cherry"} {
+		if !scan.Next() {
+			t.Fatalf("Expected '%s', got nothing instead", expect)
+		} else if got := scan.Value(); got != expect {
+			t.Fatalf("Expected '%s', got '%s' instead", expect, got)
+		}
+	}
+	if scan.Next() {
+		t.Fatalf("Expected end of iteration, got %q instead", scan.Value())
+	}
+}
+
+//edgeQuick builds an Edge from quick.Check random input, with a chance of being Inf.
+func edgeQuick(key int8, open bool) smap.Edge {
+	if key < -100 {
+		return smap.Inf
+	}
+	return smap.Edge{Key: number(key), Open: open}
+}
+
+//inInterval tells whether a number key lies within an interval.
+func inInterval(k int, i smap.Interval) bool {
+	if i.From != smap.Inf {
+		if from := int(i.From.Key.(number)); k < from || (i.From.Open && k == from) {
+			return false
+		}
+	}
+	if i.To != smap.Inf {
+		if to := int(i.To.Key.(number)); k > to || (i.To.Open && k == to) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRangeAndReverseMatchBruteForce(t *testing.T) {
+	m := New(nnFactory)
+	for k := -60; k <= 60; k += 3 {
+		m.Put(number(k), k)
+	}
+	f := func(from, to int8, fromOpen, toOpen bool) bool {
+		i := smap.Interval{From: edgeQuick(from, fromOpen), To: edgeQuick(to, toOpen)}
+		expected := []int{}
+		for k := -60; k <= 60; k += 3 {
+			if inInterval(k, i) {
+				expected = append(expected, k)
+			}
+		}
+		got := []int{}
+		for scan := m.Range(i); scan.Next(); {
+			got = append(got, scan.Value().(int))
+		}
+		reversed := []int{}
+		for scan := m.RangeReverse(i); scan.Next(); {
+			reversed = append([]int{scan.Value().(int)}, reversed...)
+		}
+		return fmt.Sprint(got) == fmt.Sprint(expected) && fmt.Sprint(reversed) == fmt.Sprint(expected)
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+}
+
+//seekExpected returns what a brute force Seek over the interval should yield.
+func seekExpected(i smap.Interval, key int, reverse bool) (int, bool) {
+	best, found := 0, false
+	for k := -60; k <= 60; k += 3 {
+		if !inInterval(k, i) {
+			continue
+		}
+		if !reverse && k >= key && (!found || k < best) {
+			best, found = k, true
+		} else if reverse && k <= key && (!found || k > best) {
+			best, found = k, true
+		}
+	}
+	return best, found
+}
+
+func TestSeekMatchBruteForce(t *testing.T) {
+	m := New(nnFactory)
+	for k := -60; k <= 60; k += 3 {
+		m.Put(number(k), k)
+	}
+	f := func(from, to int8, fromOpen, toOpen bool, first, second int8) bool {
+		i := smap.Interval{From: edgeQuick(from, fromOpen), To: edgeQuick(to, toOpen)}
+		for _, reverse := range []bool{false, true} {
+			var it smap.SeekableIterator
+			if reverse {
+				it = m.RangeReverse(i).(smap.SeekableIterator)
+			} else {
+				it = m.Range(i).(smap.SeekableIterator)
+			}
+			//seek twice to make sure the iterator can be repositioned in any direction
+			for _, key := range []int8{first, second} {
+				expected, found := seekExpected(i, int(key), reverse)
+				if it.Seek(number(key)) != found || (found && it.Value() != expected) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSeekThenNext(t *testing.T) {
+	testData.load()
+	store := getLoadedStore(testData.words)
+	sorted_words := sort.StringSlice(testData.words)
+	scan := store.Range(smap.Interval{}).(smap.SeekableIterator)
+	for _, word := range []string{"world", "hello", "zebra"} {
+		start := sorted_words.Search(word)
+		if !scan.Seek(str(word)) {
+			t.Fatalf("Expected Seek('%s') to find a word", word)
+		}
+		for i := start; i < start+10; i++ {
+			if got := scan.Value(); got != testData.words[i] {
+				t.Fatalf("Expected '%s' after Seek('%s'), got '%s'", testData.words[i], word, got)
+			}
+			scan.Next()
+		}
+	}
+}
+
+func TestSeekSkipsTombstones(t *testing.T) {
+	m := NewWithTombstones(ssFactory)
+	for _, word := range shortWordList {
+		m.Put(str(word), word)
+	}
+	m.Delete(str("cherry"))
+	scan := m.Range(smap.Interval{}).(smap.SeekableIterator)
+	if !scan.Seek(str("cherry")) || scan.Value() != "lemon" {
+		t.Fatalf("Expected Seek('cherry') to land on 'lemon'")
+	}
+}
+
+func TestPrefixRangeMatchBruteForce(t *testing.T) {
+	words := []string{"", "a", "ab", "abc", "abd", "ac", "b", "b\xff", "b\xff\x00", "b\xff\xff", "c", "\x7f", "\x7f\x01", "\x80", "é", "éa", "ê", "\xff", "\xff\xff", "\xff\xffa"}
+	m := New(ssFactory)
+	for _, w := range words {
+		m.Put(str(w), w)
+	}
+	for _, prefix := range append(words, "abcd", "bb", "\xfe") {
+		expected := []string{}
+		for _, w := range words {
+			if strings.HasPrefix(w, prefix) {
+				expected = append(expected, w)
+			}
+		}
+		got, interval := []string{}, []string{}
+		for it := m.PrefixRange(str(prefix)); it.Next(); {
+			got = append(got, it.Value().(string))
+		}
+		for it := m.Range(smap.PrefixInterval(str(prefix))); it.Next(); {
+			interval = append(interval, it.Value().(string))
+		}
+		if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", expected) || fmt.Sprintf("%q", interval) != fmt.Sprintf("%q", expected) {
+			t.Fatalf("Prefix %q: expected %q, got %q and %q on the interval", prefix, expected, got, interval)
+		}
+	}
+}
+
+func TestPrefixRangeSeek(t *testing.T) {
+	m := New(ssFactory)
+	for _, w := range []string{"a", "ba", "bb", "bc", "c"} {
+		m.Put(str(w), w)
+	}
+	it := m.PrefixRange(str("b")).(smap.SeekableIterator)
+	if !it.Seek(str("bb")) || it.Key() != str("bb") {
+		t.Fatalf("Expected to seek to 'bb'")
+	}
+	if !it.Seek(str("a")) || it.Key() != str("ba") {
+		t.Fatalf("Expected seeking before the prefix to go back to 'ba'")
+	}
+	if it.Seek(str("bd")) || it.Next() {
+		t.Fatalf("Expected seeking past the prefix to end the iteration")
+	}
+}
+
+func TestSequences(t *testing.T) {
+	m := New(nnFactory)
+	for k := 0; k < 10; k++ {
+		m.Put(number(k), k)
+	}
+	got := []int{}
+	for k, v := range m.All() {
+		if int(k.(number)) != v.(int) {
+			t.Fatalf("Expected key and value to match, got %v=%v", k, v)
+		}
+		got = append(got, v.(int))
+	}
+	for _, v := range m.Backward() {
+		got = append(got, v.(int))
+	}
+	for _, v := range m.Between(smap.Interval{From: smap.Edge{Key: number(3)}, To: smap.Edge{Key: number(6), Open: true}}) {
+		got = append(got, v.(int))
+	}
+	if expected := "[0 1 2 3 4 5 6 7 8 9 9 8 7 6 5 4 3 2 1 0 3 4 5]"; fmt.Sprint(got) != expected {
+		t.Fatalf("Expected %s, got %v", expected, got)
+	}
+}
+
+func TestBreakClosesScanner(t *testing.T) {
+	m := New(nnFactory)
+	for k := 0; k < 100; k++ {
+		m.Put(number(k), k)
+	}
+	words := New(ssFactory)
+	words.Put(str("lemon"), "lemon")
+	words.Put(str("lime"), "lime")
+	for _, it := range []smap.Iterator{m.Range(smap.Interval{}), m.Range(smap.Interval{To: smap.Edge{Key: number(50)}}), words.PrefixRange(str("l"))} {
+		for range smap.All(it) {
+			break
+		}
+		if it.Next() {
+			t.Fatalf("Expected a closed scanner to end the iteration")
+		}
+	}
+	scanner := m.Range(smap.Interval{}).(*Scanner)
+	for range smap.All(scanner) {
+		break
+	}
+	if scanner.it != nil {
+		t.Fatalf("Expected the scanner stack to be released")
+	}
+	//the released stack is reused, and must come back empty
+	got := []smap.Key{}
+	for k := range m.Between(smap.Interval{From: smap.Edge{Key: number(97)}}) {
+		got = append(got, k)
+	}
+	if fmt.Sprint(got) != "[97 98 99]" {
+		t.Fatalf("Expected [97 98 99], got %v", got)
+	}
+}
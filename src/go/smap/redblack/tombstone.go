@@ -0,0 +1,45 @@
+package redblack
+
+import (
+	"github.com/losmonos/stork/src/go/smap"
+)
+
+//tombstone is the empty Entry stored in place of deleted keys in tombstone mode.
+type tombstone struct {
+	key smap.Key
+}
+
+func (t *tombstone) GetKey() smap.Key { return t.key }
+
+func (t *tombstone) GetValue() smap.Value { return nil }
+
+//SetValue is never called on tombstones, Put() replaces empty entries instead.
+func (t *tombstone) SetValue(v smap.Value) { panic("SetValue on a tombstone") }
+
+func (t *tombstone) Size() int { return 0 }
+
+func (t *tombstone) Empty() bool { return true }
+
+//tombstoneFactory is an EntryFactory that ignores the value and builds a tombstone.
+func tombstoneFactory(key smap.Key, value smap.Value) Entry {
+	return &tombstone{key}
+}
+
+//enforce tombstone implements Entry
+var _ Entry = &tombstone{}
+
+//bury replaces the entry for key with a tombstone, inserting one if the key wasn't present.
+//It returns the value the key held and a boolean indicating if it was found.
+func (m *RedBlack) bury(key smap.Key) (v smap.Value, found bool) {
+	if node := m.tree.find(key); node != nil && node.value.Empty() {
+		return nil, false
+	}
+	m.tree.upsert(key, func(old Entry, exists bool) Entry {
+		if exists {
+			v, found = old.GetValue(), true
+			m.bytes -= old.Size()
+		}
+		return tombstoneFactory(key, nil)
+	})
+	return v, found
+}
@@ -0,0 +1,142 @@
+package redblack
+
+import (
+	"github.com/losmonos/stork/src/go/smap"
+	"testing"
+)
+
+func TestTombstoneDelete(t *testing.T) {
+	m := NewWithTombstones(ssFactory)
+	for _, word := range shortWordList {
+		m.Put(str(word), word)
+	}
+	if v, found := m.Delete(str("lemon")); !found || v != "lemon" {
+		t.Fatalf("Expected to delete 'lemon', got %q, %v", v, found)
+	}
+	if v, found := m.Get(str("lemon")); found {
+		t.Fatalf("Expected 'lemon' to be deleted, got %q", v)
+	}
+	if v, found := m.Delete(str("lemon")); found {
+		t.Fatalf("Expected second delete to find nothing, got %q", v)
+	}
+	if expected := len(shortWordList) - 1; m.Len() != expected {
+		t.Fatalf("Expected length %d, got %d", expected, m.Len())
+	}
+	if expected := 2 * len("blueberrycherryorange"); m.Size() != expected {
+		t.Fatalf("Expected size %d, got %d", expected, m.Size())
+	}
+	m.Put(str("lemon"), "again")
+	if v, found := m.Get(str("lemon")); !found || v != "again" {
+		t.Fatalf("Expected 'lemon' to be put again, got %q, %v", v, found)
+	}
+	if m.Len() != len(shortWordList) {
+		t.Fatalf("Expected length %d, got %d", len(shortWordList), m.Len())
+	}
+}
+
+func TestRangeSkipsTombstones(t *testing.T) {
+	m := NewWithTombstones(ssFactory)
+	for _, word := range shortWordList {
+		m.Put(str(word), word)
+	}
+	m.Delete(str("cherry"))
+	m.Delete(str("orange"))
+	scan := m.Range(wordInterval("apple", "orange", false, false))
+	for _, expect := range []string{"blueberry", "lemon"} {
+		if !scan.Next() {
+			t.Fatalf("Expected '%s', got nothing instead", expect)
+		} else if got := scan.Value(); got != expect {
+			t.Fatalf("Expected '%s', got '%s' instead", expect, got)
+		}
+	}
+	if scan.Next() {
+		t.Fatalf("Expected end of iteration, got %q instead", scan.Value())
+	}
+}
+
+func TestRangeWithTombstones(t *testing.T) {
+	m := NewWithTombstones(ssFactory)
+	for _, word := range shortWordList {
+		m.Put(str(word), word)
+	}
+	m.Delete(str("cherry"))
+	//deleting a missing key still records it
+	m.Delete(str("apple"))
+	expected := []struct {
+		key       string
+		tombstone bool
+	}{{"apple", true}, {"blueberry", false}, {"cherry", true}, {"lemon", false}, {"orange", false}}
+	i := 0
+	for scan := m.RangeWithTombstones(smap.Interval{}); scan.Next(); i++ {
+		if i >= len(expected) {
+			t.Fatalf("Unexpected entry %s", scan.Key())
+		}
+		if got := scan.Key(); got != str(expected[i].key) {
+			t.Fatalf("Expected '%s', got '%s' instead", expected[i].key, got)
+		}
+		if got := scan.Tombstone(); got != expected[i].tombstone {
+			t.Fatalf("Expected tombstone %v for '%s', got %v", expected[i].tombstone, expected[i].key, got)
+		}
+	}
+	if i != len(expected) {
+		t.Fatalf("Expected %d entries, got %d", len(expected), i)
+	}
+}
+
+func TestScanMostlyTombstones(t *testing.T) {
+	m := NewWithTombstones(nnFactory)
+	for i := 0; i < 1000; i++ {
+		m.Put(number(i), i)
+	}
+	for i := 1; i < 1000; i++ {
+		m.Delete(number(i))
+	}
+	if m.Len() != 1 {
+		t.Fatalf("Expected length 1, got %d", m.Len())
+	}
+	count := 0
+	for scan := m.RangeWithTombstones(smap.Interval{}); scan.Next(); count++ {
+	}
+	if count != 1000 {
+		t.Fatalf("Expected 1000 entries, got %d", count)
+	}
+	scan := m.Range(smap.Interval{})
+	if !scan.Next() || scan.Value() != 0 {
+		t.Fatalf("Expected the only live entry to be 0")
+	}
+	if scan.Next() {
+		t.Fatalf("Expected end of iteration, got %v instead", scan.Value())
+	}
+}
+
+func TestRangeReverseSkipsTombstones(t *testing.T) {
+	m := NewWithTombstones(ssFactory)
+	for _, word := range shortWordList {
+		m.Put(str(word), word)
+	}
+	m.Delete(str("orange"))
+	scan := m.RangeReverse(smap.Interval{})
+	if !scan.Next() || scan.Value() != "lemon" {
+		t.Fatalf("Expected reverse scan to start at 'lemon'")
+	}
+	withTombstones := m.RangeReverseWithTombstones(smap.Interval{})
+	if !withTombstones.Next() || withTombstones.Key() != str("orange") || !withTombstones.Tombstone() {
+		t.Fatalf("Expected reverse scan with tombstones to start at deleted 'orange'")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	m := NewWithTombstones(ssFactory)
+	m.Put(str("lemon"), "lemon")
+	m.Put(str("orange"), "orange")
+	m.Delete(str("orange"))
+	if v, deleted, found := m.Lookup(str("lemon")); !found || deleted || v != "lemon" {
+		t.Fatalf("Expected to find 'lemon', got %q, %v, %v", v, deleted, found)
+	}
+	if _, deleted, found := m.Lookup(str("orange")); !found || !deleted {
+		t.Fatalf("Expected to find 'orange' deleted, got %v, %v", deleted, found)
+	}
+	if _, _, found := m.Lookup(str("pear")); found {
+		t.Fatalf("Expected not to find 'pear'")
+	}
+}
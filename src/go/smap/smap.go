@@ -24,16 +24,76 @@ type Interval struct {
 	From, To Edge
 }
 
-//SMap is the api of a sorted map. It comprises get, put and the scanner interface.
+//Contains tells whether a key lies within the interval.
+func (i Interval) Contains(k Key) bool {
+	if i.From != Inf {
+		if cmp := k.Cmp(i.From.Key); cmp < 0 || (cmp == 0 && i.From.Open) {
+			return false
+		}
+	}
+	if i.To != Inf {
+		if cmp := k.Cmp(i.To.Key); cmp > 0 || (cmp == 0 && i.To.Open) {
+			return false
+		}
+	}
+	return true
+}
+
+//Overlaps tells whether two intervals may share any key.
+//Nothing is assumed about the key space, so (1, 2) and (1, 2) overlap even for integer keys.
+func (i Interval) Overlaps(other Interval) bool {
+	return !endsBefore(i.To, other.From) && !endsBefore(other.To, i.From)
+}
+
+//endsBefore tells whether an interval ending at the to edge is entirely before one starting at from.
+func endsBefore(to, from Edge) bool {
+	if to == Inf || from == Inf {
+		return false
+	}
+	cmp := to.Key.Cmp(from.Key)
+	return cmp < 0 || (cmp == 0 && (to.Open || from.Open))
+}
+
+//PrefixKey is a Key that can be used as a prefix of other keys, such as byte strings or tuples.
+//IsPrefixOf tells whether k starts with the receiver, and PrefixEnd returns the smallest
+//Key greater than all the keys starting with the receiver, or nil if there's none.
+type PrefixKey interface {
+	Key
+	IsPrefixOf(k Key) bool
+	PrefixEnd() Key
+}
+
+//PrefixInterval returns the interval holding all the keys starting with prefix.
+func PrefixInterval(prefix PrefixKey) Interval {
+	i := Interval{From: Edge{Key: prefix}}
+	if end := prefix.PrefixEnd(); end != nil {
+		i.To = Edge{Key: end, Open: true}
+	}
+	return i
+}
+
+//SMap is the api of a sorted map. It comprises get, put, delete and the scanner interface.
 type SMap interface {
 	SMapReader
 	Put(key Key, v Value)
+	Delete(key Key) (v Value, found bool)
 }
 
 //SMapReader is a read only SMap
+//Range iterates the interval in ascending order, RangeReverse in descending order.
+//Floor and Ceiling find the greatest key <= key and the least key >= key,
+//Lower and Higher the greatest key < key and the least key > key,
+//and Min and Max the least and greatest keys. found is false if there's no such key.
 type SMapReader interface {
 	Get(key Key) (v Value, found bool)
 	Range(i Interval) Iterator
+	RangeReverse(i Interval) Iterator
+	Floor(key Key) (k Key, v Value, found bool)
+	Ceiling(key Key) (k Key, v Value, found bool)
+	Lower(key Key) (k Key, v Value, found bool)
+	Higher(key Key) (k Key, v Value, found bool)
+	Min() (k Key, v Value, found bool)
+	Max() (k Key, v Value, found bool)
 	Len() int
 	Size() int
 }
@@ -49,3 +109,22 @@ type Iterator interface {
 	Key() Key
 	Value() Value
 }
+
+//TombstoneIterator is an Iterator that also visits deleted entries (tombstones),
+//as needed by anyone flushing a map into a log-structured store.
+//If Tombstone() returns true, the current element is a deletion marker for Key()
+//and Value() is meaningless.
+type TombstoneIterator interface {
+	Iterator
+	Tombstone() bool
+}
+
+//SeekableIterator is an Iterator that can be repositioned without being rebuilt.
+//Seek(key) moves the iterator to the first element which key is >= key (<= key on reverse iterators)
+//that still lies within the iterator's interval. It returns like Next(): if true, Key() and Value()
+//return that element and further calls to Next() continue from there.
+//It is valid to Seek() backwards as long as the underlying map was not modified.
+type SeekableIterator interface {
+	Iterator
+	Seek(key Key) bool
+}
@@ -0,0 +1,45 @@
+package smap
+
+import (
+	"testing"
+)
+
+func interval(from, to int, fromOpen, toOpen bool) Interval {
+	return Interval{From: Edge{Key: number(from), Open: fromOpen}, To: Edge{Key: number(to), Open: toOpen}}
+}
+
+func TestContains(t *testing.T) {
+	i := interval(1, 5, true, false)
+	for k, expected := range map[int]bool{0: false, 1: false, 3: true, 5: true, 6: false} {
+		if got := i.Contains(number(k)); got != expected {
+			t.Errorf("Expected Contains(%d) to be %v", k, expected)
+		}
+	}
+	if !(Interval{}).Contains(number(42)) {
+		t.Errorf("Expected the infinite interval to contain everything")
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	cases := []struct {
+		a, b     Interval
+		expected bool
+	}{
+		{interval(1, 5, false, false), interval(5, 9, false, false), true},
+		{interval(1, 5, false, true), interval(5, 9, false, false), false},
+		{interval(1, 5, false, false), interval(5, 9, true, false), false},
+		{interval(1, 5, false, false), interval(6, 9, false, false), false},
+		{interval(1, 9, false, false), interval(3, 4, false, false), true},
+		{Interval{To: Edge{Key: number(3)}}, interval(3, 4, false, false), true},
+		{Interval{From: Edge{Key: number(5)}}, interval(3, 4, false, false), false},
+		{Interval{}, interval(3, 4, true, true), true},
+	}
+	for _, c := range cases {
+		if got := c.a.Overlaps(c.b); got != c.expected {
+			t.Errorf("Expected %v.Overlaps(%v) to be %v", c.a, c.b, c.expected)
+		}
+		if got := c.b.Overlaps(c.a); got != c.expected {
+			t.Errorf("Expected %v.Overlaps(%v) to be %v", c.b, c.a, c.expected)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/losmonos/stork/src/go/smap"
+	"hash/crc32"
+)
+
+//kind tells whether an entry holds a value or is a tombstone.
+type kind byte
+
+const (
+	kindValue     kind = 0
+	kindTombstone kind = 1
+)
+
+const (
+	//crcSize is the size of the checksum trailing every block.
+	crcSize = 4
+	//footerSize is the size of the fixed footer at the end of every table.
+	footerSize = 56
+	//magic identifies stork table files.
+	magic uint64 = 0x6b726f7473737463
+)
+
+var (
+	//ErrCorrupt is returned when a table fails its checksums or can't be parsed.
+	ErrCorrupt = errors.New("sstable: corrupt table")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+//entry is a decoded data block entry.
+type entry struct {
+	key       smap.Key
+	value     smap.Value
+	tombstone bool
+}
+
+//blockHandle locates a data block in the file, along with the last key it holds.
+type blockHandle struct {
+	lastKey smap.Key
+	offset  int64
+	length  int64
+}
+
+//footer is the fixed size trailer of a table. A zero filterLength means there's no filter block.
+type footer struct {
+	filterOffset, filterLength int64
+	indexOffset, indexLength   int64
+	length, size               int64
+}
+
+func (f *footer) encode() []byte {
+	buf := make([]byte, footerSize)
+	binary.LittleEndian.PutUint64(buf[0:], uint64(f.filterOffset))
+	binary.LittleEndian.PutUint64(buf[8:], uint64(f.filterLength))
+	binary.LittleEndian.PutUint64(buf[16:], uint64(f.indexOffset))
+	binary.LittleEndian.PutUint64(buf[24:], uint64(f.indexLength))
+	binary.LittleEndian.PutUint64(buf[32:], uint64(f.length))
+	binary.LittleEndian.PutUint64(buf[40:], uint64(f.size))
+	binary.LittleEndian.PutUint64(buf[48:], magic)
+	return buf
+}
+
+//decodeFooter parses a footer, as read from the end of a table.
+func decodeFooter(buf []byte) (footer, error) {
+	var f footer
+	if len(buf) != footerSize || binary.LittleEndian.Uint64(buf[48:]) != magic {
+		return f, ErrCorrupt
+	}
+	f.filterOffset = int64(binary.LittleEndian.Uint64(buf[0:]))
+	f.filterLength = int64(binary.LittleEndian.Uint64(buf[8:]))
+	f.indexOffset = int64(binary.LittleEndian.Uint64(buf[16:]))
+	f.indexLength = int64(binary.LittleEndian.Uint64(buf[24:]))
+	f.length = int64(binary.LittleEndian.Uint64(buf[32:]))
+	f.size = int64(binary.LittleEndian.Uint64(buf[40:]))
+	return f, nil
+}
+
+//appendBytes appends a uvarint length prefixed byte slice.
+func appendBytes(buf, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+//readBytes parses a uvarint length prefixed byte slice, returning it and the remaining buffer.
+func readBytes(buf []byte) ([]byte, []byte, error) {
+	length, n := binary.Uvarint(buf)
+	if n <= 0 || uint64(len(buf)-n) < length {
+		return nil, nil, ErrCorrupt
+	}
+	return buf[n : n+int(length)], buf[n+int(length):], nil
+}
+
+//checkBlock verifies a block against its trailing checksum and returns its contents.
+func checkBlock(buf []byte) ([]byte, error) {
+	if len(buf) < crcSize {
+		return nil, ErrCorrupt
+	}
+	contents := buf[:len(buf)-crcSize]
+	if crc32.Checksum(contents, crcTable) != binary.LittleEndian.Uint32(buf[len(contents):]) {
+		return nil, ErrCorrupt
+	}
+	return contents, nil
+}
+
+//sealBlock appends the checksum of a block.
+func sealBlock(contents []byte) []byte {
+	return binary.LittleEndian.AppendUint32(contents, crc32.Checksum(contents, crcTable))
+}
+
+//decodeBlock parses the entries of a data block.
+func decodeBlock(contents []byte, codec smap.Codec) ([]entry, error) {
+	entries := []entry{}
+	for len(contents) > 0 {
+		var e entry
+		var key, value []byte
+		var err error
+		switch kind(contents[0]) {
+		case kindValue:
+		case kindTombstone:
+			e.tombstone = true
+		default:
+			return nil, ErrCorrupt
+		}
+		if key, contents, err = readBytes(contents[1:]); err != nil {
+			return nil, err
+		}
+		if value, contents, err = readBytes(contents); err != nil {
+			return nil, err
+		}
+		if e.key, err = codec.DecodeKey(key); err != nil {
+			return nil, err
+		}
+		if !e.tombstone {
+			if e.value, err = codec.DecodeValue(value); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+//decodeIndex parses the block handles of the index block.
+func decodeIndex(contents []byte, codec smap.Codec) ([]blockHandle, error) {
+	handles := []blockHandle{}
+	for len(contents) > 0 {
+		var h blockHandle
+		key, rest, err := readBytes(contents)
+		if err != nil {
+			return nil, err
+		}
+		if h.lastKey, err = codec.DecodeKey(key); err != nil {
+			return nil, err
+		}
+		offset, n := binary.Uvarint(rest)
+		if n <= 0 {
+			return nil, ErrCorrupt
+		}
+		length, m := binary.Uvarint(rest[n:])
+		if m <= 0 {
+			return nil, ErrCorrupt
+		}
+		h.offset, h.length = int64(offset), int64(length)
+		handles = append(handles, h)
+		contents = rest[n+m:]
+	}
+	return handles, nil
+}
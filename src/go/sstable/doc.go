@@ -0,0 +1,22 @@
+//Immutable sorted string tables.
+//A table is written once, in key order, typically by flushing a RedBlack memtable
+//after its Size() crosses a threshold, and then it is only read.
+//Reader implements smap.SMapReader, so a table on disk can stand in for an in-memory map.
+//
+//A table file is laid out as:
+//
+//	data block 0 | ... | data block n | filter block | index block | footer
+//
+//Data blocks hold consecutive entries, each one being a kind byte (value or tombstone),
+//the uvarint length of the encoded key, the key, the uvarint length of the encoded value
+//and the value. The index block holds, for every data block, the uvarint length of
+//its last key, the key, and the uvarint offset and length of the block.
+//The optional filter block is a Bloom filter over the keys, tombstones included,
+//hashed by their smap.EncodableKey encoding or, for other keys, by the Codec one,
+//followed by its amount of probes. It lets Get() skip the tables that don't hold a key
+//without reading any data block.
+//Every block is followed by the crc32c of its contents.
+//The fixed size footer holds the offset and length of the filter block (zero if there's
+//none) and of the index block, the amount of live entries and their size, and a magic number.
+//All fixed size integers are little endian.
+package sstable
@@ -0,0 +1,91 @@
+package sstable
+
+import (
+	"github.com/losmonos/stork/src/go/smap"
+	"hash/fnv"
+	"math"
+)
+
+//DefaultBitsPerKey is the default size of the Bloom filters, which gives about 1% false positives.
+const DefaultBitsPerKey = 10
+
+//bloom is a Bloom filter over the keys of a table, as encoded by filterKey.
+//The k probes are derived from a single 64 bit hash by double hashing.
+type bloom struct {
+	bits []byte
+	k    int
+}
+
+//filterKey returns the bytes of key hashed by the filter: its smap.EncodableKey encoding,
+//which doesn't depend on the table Codec, or the Codec one for other keys.
+func filterKey(key smap.Key, codec smap.KeyCodec) ([]byte, error) {
+	if k, ok := key.(smap.EncodableKey); ok {
+		return k.MarshalKey(), nil
+	}
+	return codec.EncodeKey(key)
+}
+
+//hashKey hashes an encoded key for the filter.
+func hashKey(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	return h.Sum64()
+}
+
+//newBloom builds a filter holding the given key hashes.
+func newBloom(hashes []uint64, bitsPerKey int) bloom {
+	n := len(hashes) * bitsPerKey
+	if n < 64 {
+		n = 64
+	}
+	k := int(math.Round(float64(bitsPerKey) * math.Ln2))
+	if k < 1 {
+		k = 1
+	} else if k > 30 {
+		k = 30
+	}
+	b := bloom{bits: make([]byte, (n+7)/8), k: k}
+	for _, h := range hashes {
+		b.add(h)
+	}
+	return b
+}
+
+//probes calls f with the bit positions of a hash, until it returns false.
+func (b bloom) probes(h uint64, f func(bit uint64) bool) bool {
+	n := uint64(len(b.bits) * 8)
+	delta := h>>33 | h<<31
+	for i := 0; i < b.k; i++ {
+		if !f(h % n) {
+			return false
+		}
+		h += delta
+	}
+	return true
+}
+
+func (b bloom) add(h uint64) {
+	b.probes(h, func(bit uint64) bool {
+		b.bits[bit/8] |= 1 << (bit % 8)
+		return true
+	})
+}
+
+//mayContain returns false if the key with the given hash is surely not in the filter.
+func (b bloom) mayContain(h uint64) bool {
+	return b.probes(h, func(bit uint64) bool {
+		return b.bits[bit/8]&(1<<(bit%8)) != 0
+	})
+}
+
+//encode returns the filter bits followed by the amount of probes.
+func (b bloom) encode() []byte {
+	return append(append([]byte{}, b.bits...), byte(b.k))
+}
+
+func decodeBloom(contents []byte) (bloom, error) {
+	if len(contents) < 2 || contents[len(contents)-1] == 0 {
+		return bloom{}, ErrCorrupt
+	}
+	return bloom{bits: contents[:len(contents)-1], k: int(contents[len(contents)-1])}, nil
+}
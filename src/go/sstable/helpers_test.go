@@ -0,0 +1,18 @@
+//Helpers for testing tables with string and int Keys, see fixtures.
+package sstable
+
+import (
+	"github.com/losmonos/stork/src/go/internal/fixtures"
+)
+
+type (
+	str      = fixtures.Str
+	strCodec = fixtures.StrCodec
+	number   = fixtures.Number
+	nnCodec  = fixtures.NNCodec
+)
+
+var (
+	ssFactory = fixtures.SSFactory
+	nnFactory = fixtures.NNFactory
+)
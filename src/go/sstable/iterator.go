@@ -0,0 +1,158 @@
+package sstable
+
+import (
+	"github.com/losmonos/stork/src/go/smap"
+)
+
+//iterator walks the table entries within an interval, one block at a time.
+//origin and end are the interval edges in iteration order, so they are swapped for reverse iterators.
+//start is where the iterator was last positioned, origin unless Seek() was called.
+//It implements smap.TombstoneIterator and smap.SeekableIterator.
+type iterator struct {
+	r          *Reader
+	origin     smap.Edge
+	start, end smap.Edge
+	reverse    bool
+	tombstones bool
+	block      int
+	entries    []entry
+	pos        int
+	done       bool
+}
+
+//newIterator builds an iterator positioned right before the start of the interval.
+func (r *Reader) newIterator(i smap.Interval, reverse, tombstones bool) *iterator {
+	it := &iterator{r: r, origin: i.From, end: i.To, reverse: reverse, tombstones: tombstones}
+	if reverse {
+		it.origin, it.end = i.To, i.From
+	}
+	it.position(it.origin)
+	return it
+}
+
+//cmp compares a key with an edge in iteration order.
+func (it *iterator) cmp(key smap.Key, edge smap.Edge) int {
+	if it.reverse {
+		return -key.Cmp(edge.Key)
+	}
+	return key.Cmp(edge.Key)
+}
+
+//beforeStart tells whether a key comes before the start edge.
+func (it *iterator) beforeStart(key smap.Key) bool {
+	if it.start == smap.Inf {
+		return false
+	}
+	c := it.cmp(key, it.start)
+	return c < 0 || (c == 0 && it.start.Open)
+}
+
+//afterEnd tells whether a key comes after the end edge.
+func (it *iterator) afterEnd(key smap.Key) bool {
+	if it.end == smap.Inf {
+		return false
+	}
+	c := it.cmp(key, it.end)
+	return c > 0 || (c == 0 && it.end.Open)
+}
+
+//position loads the block where the first entry at or after the start edge may be.
+func (it *iterator) position(start smap.Edge) {
+	it.start, it.done = start, false
+	n := len(it.r.index)
+	block := 0
+	if it.reverse {
+		block = n - 1
+	}
+	if start != smap.Inf {
+		block = it.r.searchBlock(start.Key)
+		if it.reverse && block == n {
+			block = n - 1
+		}
+	}
+	if block < 0 || block >= n {
+		it.done = true
+		return
+	}
+	it.load(block)
+}
+
+//load reads a block and positions the iterator before its first entry in iteration order.
+func (it *iterator) load(block int) bool {
+	entries, err := it.r.readBlock(block)
+	if err != nil {
+		it.r.fail(err)
+		it.done = true
+		return false
+	}
+	it.block, it.entries, it.pos = block, entries, -1
+	if it.reverse {
+		it.pos = len(entries)
+	}
+	return true
+}
+
+//step moves to the next entry in iteration order, crossing blocks as needed.
+func (it *iterator) step() bool {
+	if it.reverse {
+		for it.pos <= 0 {
+			if it.block == 0 || !it.load(it.block-1) {
+				return false
+			}
+		}
+		it.pos--
+	} else {
+		for it.pos >= len(it.entries)-1 {
+			if it.block == len(it.r.index)-1 || !it.load(it.block+1) {
+				return false
+			}
+		}
+		it.pos++
+	}
+	return true
+}
+
+//Next advances the iterator one step and if returns true, an entry will be available upon calling Key() and Value()
+func (it *iterator) Next() bool {
+	for !it.done && it.step() {
+		e := &it.entries[it.pos]
+		if it.beforeStart(e.key) {
+			continue
+		}
+		if it.afterEnd(e.key) {
+			break
+		}
+		if it.tombstones || !e.tombstone {
+			return true
+		}
+	}
+	it.done = true
+	return false
+}
+
+//Seek repositions the iterator, see smap.SeekableIterator.
+func (it *iterator) Seek(key smap.Key) bool {
+	edge := smap.Edge{Key: key}
+	if it.origin != smap.Inf {
+		if c := it.cmp(key, it.origin); c < 0 || (c == 0 && it.origin.Open) {
+			edge = it.origin
+		}
+	}
+	it.position(edge)
+	return it.Next()
+}
+
+//Key returns the current key in the iterator.
+func (it *iterator) Key() smap.Key {
+	return it.entries[it.pos].key
+}
+
+//Value returns the current value in the iterator.
+func (it *iterator) Value() smap.Value {
+	return it.entries[it.pos].value
+}
+
+//Tombstone tells whether the current entry is a tombstone.
+func (it *iterator) Tombstone() bool {
+	return it.entries[it.pos].tombstone
+}
@@ -0,0 +1,254 @@
+package sstable
+
+import (
+	"github.com/losmonos/stork/src/go/smap"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+//Reader gives access to a table. It implements smap.SMapReader and is safe for concurrent use.
+//Since smap.SMapReader has no room for I/O errors, Get() reports them as missing keys and
+//iterators stop early. The first such error is kept and returned by Err().
+type Reader struct {
+	r      io.ReaderAt
+	closer io.Closer
+	opts   Options
+	index  []blockHandle
+	filter *bloom
+	footer footer
+	mu     sync.Mutex
+	err    error
+}
+
+//Open opens the table file at path.
+func Open(path string, opts Options) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	r, err := NewReader(file, info.Size(), opts)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	r.closer = file
+	return r, nil
+}
+
+//NewReader reads a table of the given size from r. The footer, the filter and the index are loaded upfront.
+func NewReader(r io.ReaderAt, size int64, opts Options) (*Reader, error) {
+	if size < footerSize {
+		return nil, ErrCorrupt
+	}
+	buf := make([]byte, footerSize)
+	if _, err := r.ReadAt(buf, size-footerSize); err != nil {
+		return nil, err
+	}
+	f, err := decodeFooter(buf)
+	if err != nil {
+		return nil, err
+	}
+	if f.indexOffset < 0 || f.indexLength < crcSize || f.indexOffset+f.indexLength > size-footerSize {
+		return nil, ErrCorrupt
+	}
+	var filter *bloom
+	if f.filterLength > 0 {
+		if f.filterOffset < 0 || f.filterLength < crcSize || f.filterOffset+f.filterLength > f.indexOffset {
+			return nil, ErrCorrupt
+		}
+		buf = make([]byte, f.filterLength)
+		if _, err := r.ReadAt(buf, f.filterOffset); err != nil {
+			return nil, err
+		}
+		contents, err := checkBlock(buf)
+		if err != nil {
+			return nil, err
+		}
+		b, err := decodeBloom(contents)
+		if err != nil {
+			return nil, err
+		}
+		filter = &b
+	}
+	buf = make([]byte, f.indexLength)
+	if _, err := r.ReadAt(buf, f.indexOffset); err != nil {
+		return nil, err
+	}
+	contents, err := checkBlock(buf)
+	if err != nil {
+		return nil, err
+	}
+	index, err := decodeIndex(contents, opts.Codec)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{r: r, opts: opts.withDefaults(), index: index, filter: filter, footer: f}, nil
+}
+
+//Close releases the table file, if the Reader was built by Open().
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+//Err returns the first error found while reading the table.
+func (r *Reader) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+//fail records an error, keeping the first one.
+func (r *Reader) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+//readBlock loads and decodes the i-th data block.
+func (r *Reader) readBlock(i int) ([]entry, error) {
+	h := r.index[i]
+	buf := make([]byte, h.length)
+	if _, err := r.r.ReadAt(buf, h.offset); err != nil {
+		return nil, err
+	}
+	contents, err := checkBlock(buf)
+	if err != nil {
+		return nil, err
+	}
+	return decodeBlock(contents, r.opts.Codec)
+}
+
+//searchBlock returns the first block which last key is >= key, len(index) if there's none.
+func (r *Reader) searchBlock(key smap.Key) int {
+	return sort.Search(len(r.index), func(i int) bool {
+		return r.index[i].lastKey.Cmp(key) >= 0
+	})
+}
+
+//Len returns the amount of entries in the table, tombstones excluded.
+func (r *Reader) Len() int {
+	return int(r.footer.length)
+}
+
+//Size returns the size of the encoded keys and values in the table, tombstones excluded.
+func (r *Reader) Size() int {
+	return int(r.footer.size)
+}
+
+//Get searches for a given key and returns it's associated value
+//and a boolean indicating if it was found. Tombstones are reported as not found.
+func (r *Reader) Get(key smap.Key) (v smap.Value, found bool) {
+	if e, found := r.lookup(key); found && !e.tombstone {
+		return e.value, true
+	}
+	return nil, false
+}
+
+//Lookup is like Get but it also finds tombstones, reporting them as deleted.
+func (r *Reader) Lookup(key smap.Key) (v smap.Value, deleted, found bool) {
+	e, found := r.lookup(key)
+	return e.value, e.tombstone, found
+}
+
+//lookup finds the entry for key, tombstone or not.
+//The filter is checked first, so most absent keys don't cost a block read.
+func (r *Reader) lookup(key smap.Key) (entry, bool) {
+	if !r.mayContain(key) {
+		return entry{}, false
+	}
+	i := r.searchBlock(key)
+	if i == len(r.index) {
+		return entry{}, false
+	}
+	entries, err := r.readBlock(i)
+	if err != nil {
+		r.fail(err)
+		return entry{}, false
+	}
+	j := sort.Search(len(entries), func(j int) bool {
+		return entries[j].key.Cmp(key) >= 0
+	})
+	if j == len(entries) || entries[j].key.Cmp(key) != 0 {
+		return entry{}, false
+	}
+	return entries[j], true
+}
+
+//mayContain returns false if key is surely not in the table.
+func (r *Reader) mayContain(key smap.Key) bool {
+	if r.filter == nil {
+		return true
+	}
+	encoded, err := filterKey(key, r.opts.Codec)
+	if err != nil {
+		return true
+	}
+	return r.filter.mayContain(hashKey(encoded))
+}
+
+//Range returns an Iterator over the table entries within the interval, in order.
+//Tombstones are skipped.
+func (r *Reader) Range(i smap.Interval) smap.Iterator {
+	return r.newIterator(i, false, false)
+}
+
+//RangeReverse returns an Iterator over the table entries within the interval, in reverse order.
+//Tombstones are skipped.
+func (r *Reader) RangeReverse(i smap.Interval) smap.Iterator {
+	return r.newIterator(i, true, false)
+}
+
+//RangeWithTombstones is like Range() but it also visits tombstones.
+func (r *Reader) RangeWithTombstones(i smap.Interval) smap.TombstoneIterator {
+	return r.newIterator(i, false, true)
+}
+
+//RangeReverseWithTombstones is like RangeReverse() but it also visits tombstones.
+func (r *Reader) RangeReverseWithTombstones(i smap.Interval) smap.TombstoneIterator {
+	return r.newIterator(i, true, true)
+}
+
+//Floor returns the greatest key <= key in the table, along with its value.
+func (r *Reader) Floor(key smap.Key) (k smap.Key, v smap.Value, found bool) {
+	return smap.First(r.RangeReverse(smap.Interval{To: smap.Edge{Key: key}}))
+}
+
+//Ceiling returns the least key >= key in the table, along with its value.
+func (r *Reader) Ceiling(key smap.Key) (k smap.Key, v smap.Value, found bool) {
+	return smap.First(r.Range(smap.Interval{From: smap.Edge{Key: key}}))
+}
+
+//Lower returns the greatest key < key in the table, along with its value.
+func (r *Reader) Lower(key smap.Key) (k smap.Key, v smap.Value, found bool) {
+	return smap.First(r.RangeReverse(smap.Interval{To: smap.Edge{Key: key, Open: true}}))
+}
+
+//Higher returns the least key > key in the table, along with its value.
+func (r *Reader) Higher(key smap.Key) (k smap.Key, v smap.Value, found bool) {
+	return smap.First(r.Range(smap.Interval{From: smap.Edge{Key: key, Open: true}}))
+}
+
+//Min returns the least key in the table, along with its value.
+func (r *Reader) Min() (k smap.Key, v smap.Value, found bool) {
+	return smap.First(r.Range(smap.Interval{}))
+}
+
+//Max returns the greatest key in the table, along with its value.
+func (r *Reader) Max() (k smap.Key, v smap.Value, found bool) {
+	return smap.First(r.RangeReverse(smap.Interval{}))
+}
+
+//enforce Reader implements SMapReader
+var _ smap.SMapReader = &Reader{}
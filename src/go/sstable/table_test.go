@@ -0,0 +1,323 @@
+package sstable
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/smap/keys"
+	"github.com/losmonos/stork/src/go/smap/redblack"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/quick"
+)
+
+var numberOptions = Options{Codec: nnCodec{}, BlockSize: 256}
+
+//loadedTable flushes a tombstoned RedBlack holding every third number in [-3000, 3000],
+//with every seventh of them deleted, and opens the resulting table.
+func loadedTable(t *testing.T) (*redblack.RedBlack, *Reader) {
+	m := redblack.NewWithTombstones(nnFactory)
+	for k := -3000; k <= 3000; k += 3 {
+		m.Put(number(k), k)
+	}
+	for k := -3000; k <= 3000; k += 21 {
+		m.Delete(number(k))
+	}
+	path := filepath.Join(t.TempDir(), "table.sst")
+	if err := Flush(path, m, numberOptions); err != nil {
+		t.Fatalf("Unexpected error flushing: %s", err)
+	}
+	r, err := Open(path, numberOptions)
+	if err != nil {
+		t.Fatalf("Unexpected error opening: %s", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return m, r
+}
+
+func TestFlushAndGet(t *testing.T) {
+	m, r := loadedTable(t)
+	if r.Len() != m.Len() {
+		t.Fatalf("Expected %d entries, got %d", m.Len(), r.Len())
+	}
+	if len(r.index) < 10 {
+		t.Fatalf("Expected the table to be split in blocks, got %d", len(r.index))
+	}
+	for k := -3010; k <= 3010; k++ {
+		expected, expectedFound := m.Get(number(k))
+		if got, found := r.Get(number(k)); found != expectedFound || got != expected {
+			t.Fatalf("Expected %v, %v for %d, got %v, %v", expected, expectedFound, k, got, found)
+		}
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+}
+
+//collect drains an iterator into a string, marking tombstones.
+func collect(it smap.Iterator) string {
+	var buf bytes.Buffer
+	tombstones, _ := it.(smap.TombstoneIterator)
+	for it.Next() {
+		if tombstones != nil && tombstones.Tombstone() {
+			fmt.Fprintf(&buf, "%v! ", it.Key())
+		} else {
+			fmt.Fprintf(&buf, "%v=%v ", it.Key(), it.Value())
+		}
+	}
+	return buf.String()
+}
+
+//edgeQuick builds an Edge from quick.Check random input, with a chance of being Inf.
+func edgeQuick(key int16, open bool) smap.Edge {
+	if key < -3100 {
+		return smap.Inf
+	}
+	return smap.Edge{Key: number(key % 3100), Open: open}
+}
+
+func TestRangeMatchesRedBlack(t *testing.T) {
+	m, r := loadedTable(t)
+	f := func(from, to int16, fromOpen, toOpen bool) bool {
+		i := smap.Interval{From: edgeQuick(from, fromOpen), To: edgeQuick(to, toOpen)}
+		return collect(r.Range(i)) == collect(m.Range(i)) &&
+			collect(r.RangeReverse(i)) == collect(m.RangeReverse(i)) &&
+			collect(r.RangeWithTombstones(i)) == collect(m.RangeWithTombstones(i)) &&
+			collect(r.RangeReverseWithTombstones(i)) == collect(m.RangeReverseWithTombstones(i))
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 300}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSeekMatchesRedBlack(t *testing.T) {
+	m, r := loadedTable(t)
+	f := func(from, to int16, fromOpen, toOpen bool, first, second int16) bool {
+		i := smap.Interval{From: edgeQuick(from, fromOpen), To: edgeQuick(to, toOpen)}
+		expected := []smap.SeekableIterator{m.Range(i).(smap.SeekableIterator), m.RangeReverse(i).(smap.SeekableIterator)}
+		got := []smap.SeekableIterator{r.Range(i).(smap.SeekableIterator), r.RangeReverse(i).(smap.SeekableIterator)}
+		for j := range expected {
+			for _, key := range []int16{first % 3100, second % 3100} {
+				found := expected[j].Seek(number(key))
+				if got[j].Seek(number(key)) != found || (found && got[j].Key() != expected[j].Key()) {
+					return false
+				}
+			}
+			if collect(got[j]) != collect(expected[j]) {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 300}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNavigationMatchesRedBlack(t *testing.T) {
+	m, r := loadedTable(t)
+	f := func(key int16) bool {
+		k := number(key % 3100)
+		return fmt.Sprint(r.Floor(k)) == fmt.Sprint(m.Floor(k)) &&
+			fmt.Sprint(r.Ceiling(k)) == fmt.Sprint(m.Ceiling(k)) &&
+			fmt.Sprint(r.Lower(k)) == fmt.Sprint(m.Lower(k)) &&
+			fmt.Sprint(r.Higher(k)) == fmt.Sprint(m.Higher(k))
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 300}); err != nil {
+		t.Error(err)
+	}
+	for _, k := range []number{-3000, -2999, 2999, 3000} {
+		if !f(int16(k)) {
+			t.Errorf("Navigation mismatch around %d", k)
+		}
+	}
+	if fmt.Sprint(r.Min()) != fmt.Sprint(m.Min()) || fmt.Sprint(r.Max()) != fmt.Sprint(m.Max()) {
+		t.Errorf("Expected Min and Max to be %v and %v, got %v and %v",
+			fmt.Sprint(m.Min()), fmt.Sprint(m.Max()), fmt.Sprint(r.Min()), fmt.Sprint(r.Max()))
+	}
+}
+
+func TestEmptyTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.sst")
+	if err := Flush(path, redblack.New(ssFactory), Options{Codec: strCodec{}}); err != nil {
+		t.Fatalf("Unexpected error flushing: %s", err)
+	}
+	r, err := Open(path, Options{Codec: strCodec{}})
+	if err != nil {
+		t.Fatalf("Unexpected error opening: %s", err)
+	}
+	defer r.Close()
+	if r.Len() != 0 || r.Size() != 0 {
+		t.Fatalf("Expected empty table, got %d entries of size %d", r.Len(), r.Size())
+	}
+	if v, found := r.Get(str("lemon")); found {
+		t.Fatalf("Expected not to get any value, got %q", v)
+	}
+	if scan := r.Range(smap.Interval{}); scan.Next() {
+		t.Fatalf("Empty table scan returned non empty results. got %q", scan.Value())
+	}
+	if scan := r.RangeReverse(smap.Interval{}); scan.Next() {
+		t.Fatalf("Empty table scan returned non empty results. got %q", scan.Value())
+	}
+}
+
+func TestStringTable(t *testing.T) {
+	m := redblack.New(ssFactory)
+	for _, word := range []string{"blueberry", "cherry", "lemon", "orange"} {
+		m.Put(str(word), word+"!")
+	}
+	path := filepath.Join(t.TempDir(), "words.sst")
+	opts := Options{Codec: strCodec{}}
+	if err := Flush(path, m, opts); err != nil {
+		t.Fatalf("Unexpected error flushing: %s", err)
+	}
+	r, err := Open(path, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error opening: %s", err)
+	}
+	defer r.Close()
+	if v, found := r.Get(str("lemon")); !found || v != "lemon!" {
+		t.Fatalf("Expected 'lemon!', got %q", v)
+	}
+	if expected := m.Size(); r.Size() != expected {
+		t.Fatalf("Expected size %d, got %d", expected, r.Size())
+	}
+}
+
+func TestCorruptBlock(t *testing.T) {
+	_, r := loadedTable(t)
+	path := r.closer.(*os.File).Name()
+	data, _ := os.ReadFile(path)
+	data[3] ^= 0xff
+	os.WriteFile(path, data, 0644)
+	if v, found := r.Get(number(-2997)); found {
+		t.Fatalf("Expected corrupt block to yield nothing, got %v", v)
+	}
+	if r.Err() != ErrCorrupt {
+		t.Fatalf("Expected ErrCorrupt, got %v", r.Err())
+	}
+	if scan := r.Range(smap.Interval{}); scan.Next() {
+		t.Fatalf("Expected corrupt block to stop the scan, got %v", scan.Value())
+	}
+}
+
+func TestCorruptFooter(t *testing.T) {
+	_, r := loadedTable(t)
+	path := r.closer.(*os.File).Name()
+	data, _ := os.ReadFile(path)
+	data[len(data)-1] ^= 0xff
+	os.WriteFile(path, data, 0644)
+	if _, err := Open(path, numberOptions); err != ErrCorrupt {
+		t.Fatalf("Expected ErrCorrupt, got %v", err)
+	}
+}
+
+func TestKeysOutOfOrder(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, numberOptions)
+	w.Add(number(2), 2, false)
+	if err := w.Add(number(1), 1, false); err == nil {
+		t.Fatalf("Expected an error adding keys out of order")
+	}
+}
+
+//countingReader counts the reads made on a table.
+type countingReader struct {
+	*bytes.Reader
+	reads int
+}
+
+func (c *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	c.reads++
+	return c.Reader.ReadAt(p, off)
+}
+
+//buildTable writes the even numbers in [0, 2000) into an in-memory table.
+func buildTable(t *testing.T, opts Options) []byte {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, opts)
+	for k := 0; k < 2000; k += 2 {
+		w.Add(number(k), k, k%10 == 0)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error writing: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestFilterSkipsBlockReads(t *testing.T) {
+	data := buildTable(t, numberOptions)
+	cr := &countingReader{Reader: bytes.NewReader(data)}
+	r, err := NewReader(cr, int64(len(data)), numberOptions)
+	if err != nil {
+		t.Fatalf("Unexpected error opening: %s", err)
+	}
+	if r.filter == nil {
+		t.Fatalf("Expected the table to have a filter")
+	}
+	cr.reads = 0
+	for k := 1; k < 2000; k += 2 {
+		if _, found := r.Get(number(k)); found {
+			t.Fatalf("Expected %d not to be found", k)
+		}
+	}
+	if cr.reads > 50 {
+		t.Fatalf("Expected the filter to avoid most block reads, got %d reads for 1000 absent keys", cr.reads)
+	}
+	for k := 0; k < 2000; k += 2 {
+		_, deleted, found := r.Lookup(number(k))
+		if !found || deleted != (k%10 == 0) {
+			t.Fatalf("Expected %d to be found, got found %v, deleted %v", k, found, deleted)
+		}
+	}
+}
+
+func TestBloomFalsePositives(t *testing.T) {
+	hashes := []uint64{}
+	for k := 0; k < 10000; k++ {
+		hashes = append(hashes, hashKey([]byte(fmt.Sprint("in", k))))
+	}
+	b := newBloom(hashes, DefaultBitsPerKey)
+	for _, h := range hashes {
+		if !b.mayContain(h) {
+			t.Fatalf("Expected no false negatives")
+		}
+	}
+	positives := 0
+	for k := 0; k < 10000; k++ {
+		if b.mayContain(hashKey([]byte(fmt.Sprint("out", k)))) {
+			positives++
+		}
+	}
+	if positives > 300 {
+		t.Fatalf("Expected about 1%% false positives, got %d out of 10000", positives)
+	}
+}
+
+func TestTableWithoutFilter(t *testing.T) {
+	opts := numberOptions
+	opts.BitsPerKey = -1
+	data := buildTable(t, opts)
+	r, err := NewReader(bytes.NewReader(data), int64(len(data)), opts)
+	if err != nil {
+		t.Fatalf("Unexpected error opening: %s", err)
+	}
+	if r.filter != nil {
+		t.Fatalf("Expected no filter")
+	}
+	if v, found := r.Get(number(4)); !found || v != 4 {
+		t.Fatalf("Expected 4, got %v", v)
+	}
+}
+
+func TestFilterKeyUsesEncodableKey(t *testing.T) {
+	key := keys.Int(-42)
+	encoded, err := filterKey(key, strCodec{})
+	if err != nil || !bytes.Equal(encoded, key.MarshalKey()) {
+		t.Fatalf("Expected the filter to hash MarshalKey() %x, got %x, %v", key.MarshalKey(), encoded, err)
+	}
+	if encoded, err := filterKey(str("lemon"), strCodec{}); err != nil || string(encoded) != "lemon" {
+		t.Fatalf("Expected the filter to fall back to the codec, got %q, %v", encoded, err)
+	}
+}
@@ -0,0 +1,209 @@
+package sstable
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/smap/redblack"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+//DefaultBlockSize is the target size of data blocks.
+const DefaultBlockSize = 4 << 10
+
+//Options configures table readers and writers. Codec is mandatory.
+//BitsPerKey sizes the Bloom filter written along with the table, a negative value disables it.
+type Options struct {
+	Codec      smap.Codec
+	BlockSize  int
+	BitsPerKey int
+}
+
+//withDefaults fills in the unset options.
+func (o Options) withDefaults() Options {
+	if o.BlockSize <= 0 {
+		o.BlockSize = DefaultBlockSize
+	}
+	if o.BitsPerKey == 0 {
+		o.BitsPerKey = DefaultBitsPerKey
+	}
+	return o
+}
+
+//errClosed is returned when adding to a closed Writer.
+var errClosed = fmt.Errorf("sstable: writer closed")
+
+//Writer builds a table from entries added in ascending key order.
+type Writer struct {
+	w       *bufio.Writer
+	opts    Options
+	block   []byte
+	index   []byte
+	offset  int64
+	lastKey smap.Key
+	encoded []byte
+	hashes  []uint64
+	footer  footer
+	err     error
+}
+
+//NewWriter creates a Writer that outputs the table to w.
+func NewWriter(w io.Writer, opts Options) *Writer {
+	return &Writer{w: bufio.NewWriter(w), opts: opts.withDefaults()}
+}
+
+//Add appends an entry to the table. Keys must be added in strictly ascending order.
+//Tombstones are stored with no value.
+func (w *Writer) Add(key smap.Key, value smap.Value, tombstone bool) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.lastKey != nil && w.lastKey.Cmp(key) >= 0 {
+		w.err = fmt.Errorf("sstable: keys out of order")
+		return w.err
+	}
+	var encodedKey, encodedValue []byte
+	if encodedKey, w.err = w.opts.Codec.EncodeKey(key); w.err != nil {
+		return w.err
+	}
+	if !tombstone {
+		if encodedValue, w.err = w.opts.Codec.EncodeValue(value); w.err != nil {
+			return w.err
+		}
+		w.footer.length++
+		w.footer.size += int64(len(encodedKey) + len(encodedValue))
+	}
+	k := kindValue
+	if tombstone {
+		k = kindTombstone
+	}
+	w.block = append(w.block, byte(k))
+	w.block = appendBytes(w.block, encodedKey)
+	w.block = appendBytes(w.block, encodedValue)
+	w.lastKey, w.encoded = key, encodedKey
+	if w.opts.BitsPerKey > 0 {
+		filtered, err := filterKey(key, w.opts.Codec)
+		if err != nil {
+			w.err = err
+			return err
+		}
+		w.hashes = append(w.hashes, hashKey(filtered))
+	}
+	if len(w.block) >= w.opts.BlockSize {
+		w.err = w.flushBlock()
+	}
+	return w.err
+}
+
+//Size returns the amount of bytes written so far, including the pending data block.
+func (w *Writer) Size() int64 {
+	return w.offset + int64(len(w.block))
+}
+
+//flushBlock writes the pending data block and records it in the index.
+func (w *Writer) flushBlock() error {
+	if len(w.block) == 0 {
+		return nil
+	}
+	block := sealBlock(w.block)
+	if _, err := w.w.Write(block); err != nil {
+		return err
+	}
+	w.index = appendBytes(w.index, w.encoded)
+	w.index = binary.AppendUvarint(w.index, uint64(w.offset))
+	w.index = binary.AppendUvarint(w.index, uint64(len(block)))
+	w.offset += int64(len(block))
+	w.block = w.block[:0]
+	return nil
+}
+
+//Close writes the pending data block, the filter, the index and the footer.
+//It doesn't close the underlying io.Writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.err = w.flushBlock(); w.err != nil {
+		return w.err
+	}
+	if w.opts.BitsPerKey > 0 {
+		filter := sealBlock(newBloom(w.hashes, w.opts.BitsPerKey).encode())
+		w.footer.filterOffset, w.footer.filterLength = w.offset, int64(len(filter))
+		if _, w.err = w.w.Write(filter); w.err != nil {
+			return w.err
+		}
+		w.offset += int64(len(filter))
+	}
+	index := sealBlock(w.index)
+	w.footer.indexOffset, w.footer.indexLength = w.offset, int64(len(index))
+	if _, w.err = w.w.Write(index); w.err != nil {
+		return w.err
+	}
+	if _, w.err = w.w.Write(w.footer.encode()); w.err != nil {
+		return w.err
+	}
+	if w.err = w.w.Flush(); w.err != nil {
+		return w.err
+	}
+	w.err = errClosed
+	return nil
+}
+
+//Write adds all the entries of an ordered iterator to w and closes it.
+//If the iterator implements smap.TombstoneIterator its tombstones are kept.
+func (w *Writer) Write(it smap.Iterator) error {
+	tombstones, _ := it.(smap.TombstoneIterator)
+	for it.Next() {
+		if tombstones != nil && tombstones.Tombstone() {
+			if err := w.Add(it.Key(), nil, true); err != nil {
+				return err
+			}
+		} else if err := w.Add(it.Key(), it.Value(), false); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+//Flush writes all the entries of a RedBlack, tombstones included, into a new table file at path.
+//The table is written to a temporary file which is renamed once synced, so path
+//either doesn't exist or holds a complete table.
+func Flush(path string, m *redblack.RedBlack, opts Options) error {
+	return Create(path, m.RangeWithTombstones(smap.Interval{}), opts)
+}
+
+//Create writes all the entries of an ordered iterator into a new table file at path, like Flush.
+func Create(path string, it smap.Iterator, opts Options) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if err = NewWriter(file, opts).Write(it); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+//syncDir fsyncs a directory, so renamed files survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
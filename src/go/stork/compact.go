@@ -0,0 +1,149 @@
+package stork
+
+import (
+	"github.com/losmonos/stork/src/go/compaction"
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/sstable"
+	"os"
+	"path/filepath"
+)
+
+//compactor runs the compactions chosen by the picker until the flusher is done.
+func (db *DB) compactor() {
+	defer db.wg.Done()
+	for range db.compact {
+		for db.compactOnce() {
+		}
+	}
+}
+
+//compactOnce runs the next compaction, if any, and installs its outputs.
+//It returns false when there's nothing to compact or the compaction failed.
+func (db *DB) compactOnce() bool {
+	db.mu.Lock()
+	if db.err != nil || db.closed {
+		db.mu.Unlock()
+		return false
+	}
+	metas := make([]compaction.Table, len(db.tables))
+	byID := make(map[uint64]*table, len(db.tables))
+	for i, t := range db.tables {
+		metas[i] = t.meta
+		byID[t.meta.ID] = t
+	}
+	task := db.opts.Compaction.Pick(metas)
+	if task == nil {
+		db.mu.Unlock()
+		return false
+	}
+	for _, t := range task.Inputs {
+		byID[t.ID].ref()
+	}
+	db.mu.Unlock()
+
+	out := &output{db: db}
+	open := func(t compaction.Table) smap.TombstoneIterator {
+		return byID[t.ID].RangeWithTombstones(smap.Interval{})
+	}
+	stats, err := compaction.Run(task, open, out, db.opts.TableSize, db.opts.Merge)
+	for _, t := range task.Inputs {
+		if err == nil {
+			err = byID[t.ID].Err()
+		}
+		byID[t.ID].unref()
+	}
+	outputs := []*table{}
+	for _, id := range out.ids {
+		if err != nil {
+			break
+		}
+		var t *table
+		if t, err = db.openTable(id, task.Level, task.Seq); err == nil {
+			outputs = append(outputs, t)
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if err == nil {
+		tables := outputs
+		for _, t := range db.tables {
+			if !task.Contains(t.meta) {
+				tables = append(tables, t)
+			}
+		}
+		err = db.install(tables, db.logFrom)
+	}
+	if err != nil {
+		for _, t := range outputs {
+			t.unref()
+		}
+		out.remove()
+		db.fail(err)
+		return false
+	}
+	//iterators may still be reading the inputs, the last one closes them and removes their files.
+	for _, t := range task.Inputs {
+		byID[t.ID].compacted.Store(true)
+		byID[t.ID].unref()
+	}
+	db.stats.Add(stats)
+	return true
+}
+
+//CompactionStats returns the statistics of all the compactions run since the DB was opened.
+func (db *DB) CompactionStats() compaction.Stats {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.stats
+}
+
+//output writes the compaction outputs into new table files.
+//A table is written to a temporary file and renamed once complete.
+type output struct {
+	db   *DB
+	ids  []uint64
+	file *os.File
+	id   uint64
+}
+
+//Create starts a new table file.
+func (o *output) Create() (*sstable.Writer, error) {
+	o.id = o.db.newID()
+	file, err := os.OpenFile(o.db.tablePath(o.id)+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	o.file = file
+	return sstable.NewWriter(file, o.db.opts.Table), nil
+}
+
+//Commit syncs the table file and gives it its final name.
+func (o *output) Commit() error {
+	err := o.file.Sync()
+	if closeErr := o.file.Close(); err == nil {
+		err = closeErr
+	}
+	o.file = nil
+	path := o.db.tablePath(o.id)
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	o.ids = append(o.ids, o.id)
+	return syncDir(filepath.Dir(path))
+}
+
+//remove deletes all the files written, to undo a failed compaction.
+func (o *output) remove() {
+	if o.file != nil {
+		o.file.Close()
+		os.Remove(o.db.tablePath(o.id) + ".tmp")
+	}
+	for _, id := range o.ids {
+		os.Remove(o.db.tablePath(id))
+	}
+}
@@ -0,0 +1,593 @@
+package stork
+
+import (
+	"fmt"
+	"github.com/losmonos/stork/src/go/compaction"
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/smap/redblack"
+	"github.com/losmonos/stork/src/go/sstable"
+	"github.com/losmonos/stork/src/go/wal"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	DefaultMemtableSize = 4 << 20
+	DefaultMaxFrozen    = 4
+	DefaultTableSize    = 8 << 20
+)
+
+//Options configures a DB. Codec and Factory are mandatory.
+//The Codec is also used by the log and the tables, so their own Codec is ignored.
+//Compaction picks the tables to compact, compaction.Leveled by default.
+//TableSize is the size at which compaction outputs are split.
+//Merge enables DB.Merge. It changes the layout of the tables, so it must be kept for the life of the DB.
+type Options struct {
+	Codec        smap.Codec
+	Factory      redblack.EntryFactory
+	MemtableSize int
+	MaxFrozen    int
+	WAL          wal.Options
+	Table        sstable.Options
+	Compaction   compaction.Picker
+	TableSize    int64
+	Merge        smap.MergeOperator
+}
+
+//withDefaults fills in the unset options.
+func (o Options) withDefaults() Options {
+	if o.MemtableSize <= 0 {
+		o.MemtableSize = DefaultMemtableSize
+	}
+	if o.MaxFrozen <= 0 {
+		o.MaxFrozen = DefaultMaxFrozen
+	}
+	if o.Compaction == nil {
+		o.Compaction = &compaction.Leveled{}
+	}
+	if o.TableSize <= 0 {
+		o.TableSize = DefaultTableSize
+	}
+	o.WAL.Codec = o.Codec
+	o.Table.Codec = o.Codec
+	if o.Merge != nil {
+		o.Table.Codec = smap.NewCodec(o.Codec, operandCodec{o.Codec})
+	}
+	return o
+}
+
+//layer is a source of entries, tombstones included: memtables and tables.
+type layer interface {
+	Lookup(key smap.Key) (v smap.Value, deleted, found bool)
+	RangeWithTombstones(i smap.Interval) smap.TombstoneIterator
+	RangeReverseWithTombstones(i smap.Interval) smap.TombstoneIterator
+	Size() int
+}
+
+//memtable is a RedBlack along with the log segment that follows it:
+//all its records are in older segments.
+type memtable struct {
+	*redblack.RedBlack
+	segment uint64
+}
+
+//tombstoneSize is what every tombstone is charged when deciding whether a memtable is full.
+//Tombstones have no Size(), but a memtable full of them still takes memory and log space.
+const tombstoneSize = 16
+
+//full tells whether the memtable reached size, counting its tombstones.
+func (m *memtable) full(size int) bool {
+	return m.Size()+tombstoneSize*(m.Nodes()-m.Len()) >= size
+}
+
+//table is an open table file along with its description for compactions.
+//Tables are reference counted: the DB holds a reference on the live ones, and so do the
+//iterators and compactions reading them. The last unref() closes the table, and removes
+//its file if it was compacted.
+type table struct {
+	*sstable.Reader
+	meta      compaction.Table
+	path      string
+	refs      atomic.Int32
+	compacted atomic.Bool
+}
+
+//ref takes a reference on the table.
+func (t *table) ref() {
+	t.refs.Add(1)
+}
+
+//unref drops a reference on the table, closing it if it was the last one.
+//Failing to remove a compacted file is harmless, as it's not in the manifest anymore.
+func (t *table) unref() error {
+	if t.refs.Add(-1) > 0 {
+		return nil
+	}
+	err := t.Close()
+	if t.compacted.Load() {
+		os.Remove(t.path)
+	}
+	return err
+}
+
+//DB is a sorted map stored in dir. It implements smap.SMap and is safe for concurrent use.
+//smap.SMap has no room for errors, so once a write fails the DB stops accepting writes
+//and the error is returned by Err(). Reads report I/O errors the same way.
+//logFrom is the first log segment with records not flushed yet, as recorded in the manifest.
+type DB struct {
+	dir     string
+	opts    Options
+	mu      sync.RWMutex
+	flushed *sync.Cond
+	log     *wal.Log
+	logFrom uint64
+	active  *memtable
+	frozen  []*memtable
+	tables  []*table
+	nextID  uint64
+	flush   chan struct{}
+	compact chan struct{}
+	stats   compaction.Stats
+	wg      sync.WaitGroup
+	err     error
+	closed  bool
+}
+
+//tableSuffix is the file extension of table files.
+const tableSuffix = ".sst"
+
+//tablePath returns the path of the table file with the given id.
+func (db *DB) tablePath(id uint64) string {
+	return filepath.Join(db.dir, fmt.Sprintf("%016x%s", id, tableSuffix))
+}
+
+//Open opens the DB stored in dir, creating it if needed.
+//The tables are opened and the log is replayed into a new memtable.
+//It fails if the tables were written with a different Options.Merge setting.
+func Open(dir string, opts Options) (*DB, error) {
+	if opts.Codec == nil || opts.Factory == nil {
+		return nil, fmt.Errorf("stork: Codec and Factory are mandatory")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	db := &DB{dir: dir, opts: opts.withDefaults(), flush: make(chan struct{}, 1), compact: make(chan struct{}, 1)}
+	db.flushed = sync.NewCond(&db.mu)
+	if err := db.openTables(); err != nil {
+		db.closeTables()
+		return nil, err
+	}
+	log, err := wal.Open(filepath.Join(dir, "wal"), db.opts.WAL)
+	if err != nil {
+		db.closeTables()
+		return nil, err
+	}
+	db.log = log
+	db.active = db.newMemtable(0)
+	//a crash may have left flushed segments behind
+	if err := log.RemoveBefore(db.logFrom); err != nil {
+		log.Close()
+		db.closeTables()
+		return nil, err
+	}
+	if err := log.Replay(db.replay); err != nil {
+		log.Close()
+		db.closeTables()
+		return nil, err
+	}
+	db.compact <- struct{}{}
+	db.wg.Add(2)
+	go db.flusher()
+	go db.compactor()
+	return db, nil
+}
+
+//openTables opens the tables listed in the manifest, newest first, and removes the rest.
+//Without a manifest, all the table files are taken as flushed level 0 tables.
+func (db *DB) openTables() error {
+	names, err := filepath.Glob(filepath.Join(db.dir, "*"+tableSuffix))
+	if err != nil {
+		return err
+	}
+	ids := []uint64{}
+	for _, name := range names {
+		if id, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), tableSuffix), 16, 64); err == nil {
+			ids = append(ids, id)
+			if id >= db.nextID {
+				db.nextID = id + 1
+			}
+		}
+	}
+	m, found, err := readManifest(db.dir)
+	if err != nil {
+		return err
+	}
+	if found && m.Format != "" && m.Format != db.format() {
+		return fmt.Errorf("stork: the tables hold %s but the options expect %s, see Options.Merge", m.Format, db.format())
+	}
+	if !found {
+		for _, id := range ids {
+			m.Tables = append(m.Tables, manifestTable{ID: id, Seq: id})
+		}
+	}
+	live := map[uint64]bool{}
+	for _, mt := range m.Tables {
+		t, err := db.openTable(mt.ID, mt.Level, mt.Seq)
+		if err != nil {
+			return err
+		}
+		db.tables = append(db.tables, t)
+		live[mt.ID] = true
+	}
+	for _, id := range ids {
+		if !live[id] {
+			os.Remove(db.tablePath(id))
+		}
+	}
+	tmps, _ := filepath.Glob(filepath.Join(db.dir, "*"+tableSuffix+".tmp"))
+	for _, tmp := range tmps {
+		os.Remove(tmp)
+	}
+	return db.install(db.tables, m.LogFrom)
+}
+
+//openTable opens a table file and describes it for compactions.
+func (db *DB) openTable(id uint64, level int, seq uint64) (*table, error) {
+	path := db.tablePath(id)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := sstable.Open(path, db.opts.Table)
+	if err != nil {
+		return nil, err
+	}
+	t := &table{Reader: reader, meta: compaction.Table{ID: id, Level: level, Seq: seq, Size: info.Size()}, path: path}
+	t.ref()
+	first, last := reader.RangeWithTombstones(smap.Interval{}), reader.RangeReverseWithTombstones(smap.Interval{})
+	if first.Next() && last.Next() {
+		t.meta.Bounds = smap.Interval{From: smap.Edge{Key: first.Key()}, To: smap.Edge{Key: last.Key()}}
+	}
+	if err := reader.Err(); err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+//install replaces the live tables and records them in the manifest, along with
+//the first log segment they don't hold the records of.
+//The tables are left untouched if the manifest can't be written. It must be called with the lock held.
+func (db *DB) install(tables []*table, logFrom uint64) error {
+	sort.SliceStable(tables, func(i, j int) bool { return compaction.Newer(tables[i].meta, tables[j].meta) })
+	m := manifest{Tables: []manifestTable{}, LogFrom: logFrom, Format: db.format()}
+	for _, t := range tables {
+		m.Tables = append(m.Tables, manifestTable{ID: t.meta.ID, Level: t.meta.Level, Seq: t.meta.Seq})
+	}
+	if err := writeManifest(db.dir, m); err != nil {
+		return err
+	}
+	db.tables, db.logFrom = tables, logFrom
+	return nil
+}
+
+//format returns the format of the table values.
+func (db *DB) format() string {
+	if db.opts.Merge != nil {
+		return formatOperands
+	}
+	return formatValues
+}
+
+//newID reserves the id of a new table file.
+func (db *DB) newID() uint64 {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	id := db.nextID
+	db.nextID++
+	return id
+}
+
+//closeTables drops the references on the live tables.
+func (db *DB) closeTables() {
+	for _, t := range db.tables {
+		t.unref()
+	}
+}
+
+//newMemtable builds an empty memtable.
+func (db *DB) newMemtable(segment uint64) *memtable {
+	if db.opts.Merge != nil {
+		return &memtable{redblack.NewWithTombstones(db.mergeFactory), segment}
+	}
+	return &memtable{redblack.NewWithTombstones(db.opts.Factory), segment}
+}
+
+//replay applies a record read from the log on Open.
+func (db *DB) replay(r wal.Record) error {
+	if r.Op == wal.OpMerge && db.opts.Merge == nil {
+		return fmt.Errorf("stork: the log holds merges but there's no MergeOperator")
+	}
+	db.apply(r)
+	return nil
+}
+
+//apply performs a logged mutation on the active memtable.
+func (db *DB) apply(r wal.Record) {
+	switch r.Op {
+	case wal.OpPut:
+		db.active.Put(r.Key, r.Value)
+	case wal.OpDelete:
+		db.active.Delete(r.Key)
+	case wal.OpBatch:
+		r.Batch.ApplyTo(db.active)
+	case wal.OpMerge:
+		db.applyMerge(r.Key, r.Value)
+	}
+}
+
+//Err returns the first error that made the DB stop accepting writes.
+func (db *DB) Err() error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.err
+}
+
+//fail records an error, keeping the first one. It must be called with the lock held.
+func (db *DB) fail(err error) {
+	if db.err == nil {
+		db.err = err
+	}
+	db.flushed.Broadcast()
+}
+
+//Put inserts a value identified by a key.
+func (db *DB) Put(key smap.Key, value smap.Value) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.write(wal.Record{Op: wal.OpPut, Key: key, Value: value})
+}
+
+//Delete removes a key and returns the value it held and a boolean indicating if it was found.
+func (db *DB) Delete(key smap.Key) (v smap.Value, found bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	v, found = db.get(key)
+	if db.write(wal.Record{Op: wal.OpDelete, Key: key}) != nil {
+		return nil, false
+	}
+	return v, found
+}
+
+//Apply performs all the operations of a batch, in order and atomically:
+//they are logged as a single record, and readers see either none or all of them.
+func (db *DB) Apply(b *smap.Batch) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.write(wal.Record{Op: wal.OpBatch, Batch: b})
+}
+
+//write logs and applies a mutation, freezing the memtable if it's full.
+//It must be called with the lock held.
+func (db *DB) write(r wal.Record) error {
+	for db.err == nil && len(db.frozen) >= db.opts.MaxFrozen {
+		db.flushed.Wait()
+	}
+	if db.err != nil {
+		return db.err
+	}
+	if err := db.log.Append(r); err != nil {
+		db.fail(err)
+		return err
+	}
+	db.apply(r)
+	if db.active.full(db.opts.MemtableSize) {
+		return db.freeze()
+	}
+	return nil
+}
+
+//freeze moves the active memtable to the frozen list and signals the flusher.
+//It must be called with the lock held.
+func (db *DB) freeze() error {
+	segment, err := db.log.Rotate()
+	if err != nil {
+		db.fail(err)
+		return err
+	}
+	db.active.segment = segment
+	db.frozen = append([]*memtable{db.active}, db.frozen...)
+	db.active = db.newMemtable(0)
+	select {
+	case db.flush <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+//layers returns all the layers, newest first. It must be called with the lock held.
+func (db *DB) layers() []layer {
+	layers := make([]layer, 0, 1+len(db.frozen)+len(db.tables))
+	layers = append(layers, db.active)
+	for _, m := range db.frozen {
+		layers = append(layers, m)
+	}
+	for _, t := range db.tables {
+		layers = append(layers, t)
+	}
+	return layers
+}
+
+//Get searches for a given key and returns it's associated value
+//and a boolean indicating if it was found
+func (db *DB) Get(key smap.Key) (v smap.Value, found bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.get(key)
+}
+
+//get looks for key in the layers, stopping at the newest one that knows about it.
+//Merge operands are collected down to the layer holding the value they apply to.
+//It must be called with the lock held.
+func (db *DB) get(key smap.Key) (v smap.Value, found bool) {
+	var pending smap.Operands
+	for _, l := range db.layers() {
+		v, deleted, found := l.Lookup(key)
+		if !found {
+			continue
+		}
+		if operands, ok := v.(smap.Operands); ok && !deleted && db.opts.Merge != nil {
+			pending = append(append(smap.Operands{}, operands...), pending...)
+			continue
+		}
+		if pending != nil {
+			return db.opts.Merge.FullMerge(key, v, !deleted, pending), true
+		}
+		return v, !deleted
+	}
+	if pending != nil {
+		return db.opts.Merge.FullMerge(key, nil, false, pending), true
+	}
+	return nil, false
+}
+
+//Range returns an Iterator over the DB entries within the interval, in order.
+func (db *DB) Range(i smap.Interval) smap.Iterator {
+	return db.scan(i, false)
+}
+
+//RangeReverse returns an Iterator over the DB entries within the interval, in reverse order.
+func (db *DB) RangeReverse(i smap.Interval) smap.Iterator {
+	return db.scan(i, true)
+}
+
+//scan merges the iterators of all the layers.
+//The active memtable keeps changing, so the entries within the interval are copied,
+//the rest of the layers are immutable and are iterated in place.
+func (db *DB) scan(i smap.Interval, reverse bool) smap.Iterator {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.merge(i, reverse, true)
+}
+
+//first returns the first entry of a scan.
+//The lock is held until the entry is found, so nothing needs to be copied.
+func (db *DB) first(i smap.Interval, reverse bool) (k smap.Key, v smap.Value, found bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return smap.First(db.merge(i, reverse, false))
+}
+
+//merge merges the iterators of all the layers, copying the active memtable ones if requested.
+//The tables are referenced until the iterator is closed or exhausted. It must be called with the lock held.
+func (db *DB) merge(i smap.Interval, reverse, copyActive bool) smap.Iterator {
+	for _, t := range db.tables {
+		t.ref()
+	}
+	sources := []smap.Iterator{}
+	for n, l := range db.layers() {
+		var it smap.TombstoneIterator
+		if reverse {
+			it = l.RangeReverseWithTombstones(i)
+		} else {
+			it = l.RangeWithTombstones(i)
+		}
+		if n == 0 && copyActive {
+			it = copyIterator(it, reverse)
+		}
+		sources = append(sources, it)
+	}
+	merged := smap.NewMergeIterator(sources, smap.MergeOptions{Reverse: reverse, Operator: db.opts.Merge})
+	return newTableIterator(merged, append([]*table{}, db.tables...))
+}
+
+//Floor returns the greatest key <= key, along with its value.
+func (db *DB) Floor(key smap.Key) (k smap.Key, v smap.Value, found bool) {
+	return db.first(smap.Interval{To: smap.Edge{Key: key}}, true)
+}
+
+//Ceiling returns the least key >= key, along with its value.
+func (db *DB) Ceiling(key smap.Key) (k smap.Key, v smap.Value, found bool) {
+	return db.first(smap.Interval{From: smap.Edge{Key: key}}, false)
+}
+
+//Lower returns the greatest key < key, along with its value.
+func (db *DB) Lower(key smap.Key) (k smap.Key, v smap.Value, found bool) {
+	return db.first(smap.Interval{To: smap.Edge{Key: key, Open: true}}, true)
+}
+
+//Higher returns the least key > key, along with its value.
+func (db *DB) Higher(key smap.Key) (k smap.Key, v smap.Value, found bool) {
+	return db.first(smap.Interval{From: smap.Edge{Key: key, Open: true}}, false)
+}
+
+//Min returns the least key in the DB, along with its value.
+func (db *DB) Min() (k smap.Key, v smap.Value, found bool) {
+	return db.first(smap.Interval{}, false)
+}
+
+//Max returns the greatest key in the DB, along with its value.
+func (db *DB) Max() (k smap.Key, v smap.Value, found bool) {
+	return db.first(smap.Interval{}, true)
+}
+
+//Len returns the amount of keys in the DB.
+//Keys may be shadowed by newer layers, so this requires a full scan.
+func (db *DB) Len() int {
+	n := 0
+	for it := db.Range(smap.Interval{}); it.Next(); n++ {
+	}
+	return n
+}
+
+//Size returns the size of all the layers, including the entries shadowed by newer layers.
+func (db *DB) Size() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	size := 0
+	for _, l := range db.layers() {
+		size += l.Size()
+	}
+	return size
+}
+
+//Close waits for the frozen memtables to be flushed and releases the DB resources.
+//The active memtable is left in the log, to be replayed on the next Open().
+func (db *DB) Close() error {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return errClosed
+	}
+	db.closed = true
+	for db.err == nil && len(db.frozen) > 0 {
+		db.flushed.Wait()
+	}
+	close(db.flush)
+	db.mu.Unlock()
+	db.wg.Wait()
+	err := db.log.Close()
+	for _, t := range db.tables {
+		if closeErr := t.unref(); err == nil {
+			err = closeErr
+		}
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.err != nil {
+		err = db.err
+	}
+	db.fail(errClosed)
+	return err
+}
+
+//errClosed is returned when using a closed DB.
+var errClosed = fmt.Errorf("stork: db closed")
+
+//enforce DB implements SMap
+var _ smap.SMap = &DB{}
@@ -0,0 +1,413 @@
+package stork
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/losmonos/stork/src/go/compaction"
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/smap/redblack"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+//smallOptions makes the DB flush after a handful of entries.
+var smallOptions = Options{Codec: nnCodec{}, Factory: nnFactory, MemtableSize: 16 * 20}
+
+func openTestDB(t *testing.T, dir string, opts Options) *DB {
+	db, err := Open(dir, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error opening the DB: %s", err)
+	}
+	return db
+}
+
+//tableCount returns the amount of table files in the DB.
+func (db *DB) tableCount() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return len(db.tables)
+}
+
+//collect drains an iterator into a string.
+func collect(it smap.Iterator) string {
+	var buf bytes.Buffer
+	for it.Next() {
+		fmt.Fprintf(&buf, "%v=%v ", it.Key(), it.Value())
+	}
+	return buf.String()
+}
+
+func TestPutGetDelete(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), Options{Codec: strCodec{}, Factory: ssFactory})
+	defer db.Close()
+	db.Put(str("lemon"), "lemon")
+	db.Put(str("orange"), "orange")
+	if v, found := db.Get(str("lemon")); !found || v != "lemon" {
+		t.Fatalf("Expected 'lemon', got %q", v)
+	}
+	if v, found := db.Delete(str("lemon")); !found || v != "lemon" {
+		t.Fatalf("Expected to delete 'lemon', got %q, %v", v, found)
+	}
+	if v, found := db.Get(str("lemon")); found {
+		t.Fatalf("Expected 'lemon' to be deleted, got %q", v)
+	}
+	if db.Len() != 1 {
+		t.Fatalf("Expected 1 key, got %d", db.Len())
+	}
+	if err := db.Err(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+}
+
+//randomOps applies the same random puts and deletes to the DB and to a reference RedBlack.
+func randomOps(db *DB, model *redblack.RedBlack, r *rand.Rand, n int) {
+	for i := 0; i < n; i++ {
+		k := number(r.Intn(500))
+		if r.Intn(3) == 0 {
+			db.Delete(k)
+			model.Delete(k)
+		} else {
+			db.Put(k, i)
+			model.Put(k, i)
+		}
+	}
+}
+
+//checkModel compares the DB contents with the reference RedBlack.
+func checkModel(t *testing.T, db *DB, model *redblack.RedBlack) {
+	for k := 0; k < 500; k++ {
+		expected, expectedFound := model.Get(number(k))
+		if got, found := db.Get(number(k)); found != expectedFound || got != expected {
+			t.Fatalf("Expected %v, %v for %d, got %v, %v", expected, expectedFound, k, got, found)
+		}
+	}
+	intervals := []smap.Interval{
+		{},
+		{From: smap.Edge{Key: number(100)}, To: smap.Edge{Key: number(200), Open: true}},
+		{From: smap.Edge{Key: number(250), Open: true}},
+		{To: smap.Edge{Key: number(50)}},
+	}
+	for _, i := range intervals {
+		if expected, got := collect(model.Range(i)), collect(db.Range(i)); got != expected {
+			t.Fatalf("Range mismatch on %v:\nexpected %s\ngot      %s", i, expected, got)
+		}
+		if expected, got := collect(model.RangeReverse(i)), collect(db.RangeReverse(i)); got != expected {
+			t.Fatalf("RangeReverse mismatch on %v:\nexpected %s\ngot      %s", i, expected, got)
+		}
+	}
+	for k := -1; k <= 500; k += 7 {
+		key := number(k)
+		if expected, got := fmt.Sprint(model.Floor(key)), fmt.Sprint(db.Floor(key)); got != expected {
+			t.Fatalf("Floor mismatch on %d: expected %s, got %s", k, expected, got)
+		}
+		if expected, got := fmt.Sprint(model.Ceiling(key)), fmt.Sprint(db.Ceiling(key)); got != expected {
+			t.Fatalf("Ceiling mismatch on %d: expected %s, got %s", k, expected, got)
+		}
+		if expected, got := fmt.Sprint(model.Lower(key)), fmt.Sprint(db.Lower(key)); got != expected {
+			t.Fatalf("Lower mismatch on %d: expected %s, got %s", k, expected, got)
+		}
+		if expected, got := fmt.Sprint(model.Higher(key)), fmt.Sprint(db.Higher(key)); got != expected {
+			t.Fatalf("Higher mismatch on %d: expected %s, got %s", k, expected, got)
+		}
+	}
+	if expected, got := fmt.Sprint(model.Min()), fmt.Sprint(db.Min()); got != expected {
+		t.Fatalf("Expected Min to be %s, got %s", expected, got)
+	}
+	if expected, got := fmt.Sprint(model.Max()), fmt.Sprint(db.Max()); got != expected {
+		t.Fatalf("Expected Max to be %s, got %s", expected, got)
+	}
+	if db.Len() != model.Len() {
+		t.Fatalf("Expected %d keys, got %d", model.Len(), db.Len())
+	}
+}
+
+//noCompaction is a Picker that never compacts.
+type noCompaction struct{}
+
+func (noCompaction) Pick(tables []compaction.Table) *compaction.Task { return nil }
+
+func TestFlushAndReopen(t *testing.T) {
+	dir := t.TempDir()
+	opts := smallOptions
+	opts.Compaction = noCompaction{}
+	db := openTestDB(t, dir, opts)
+	model := redblack.New(nnFactory)
+	r := rand.New(rand.NewSource(1))
+	randomOps(db, model, r, 3000)
+	checkModel(t, db, model)
+	if db.tableCount() < 10 {
+		t.Fatalf("Expected the memtable to be flushed, got %d tables", db.tableCount())
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Unexpected error closing: %s", err)
+	}
+
+	db = openTestDB(t, dir, opts)
+	defer db.Close()
+	checkModel(t, db, model)
+	randomOps(db, model, r, 1000)
+	checkModel(t, db, model)
+}
+
+//testCompaction runs random operations with a picker, checking the DB before and after reopening it.
+func testCompaction(t *testing.T, picker compaction.Picker) {
+	dir := t.TempDir()
+	opts := smallOptions
+	opts.Compaction = picker
+	opts.TableSize = 16 * 20
+	db := openTestDB(t, dir, opts)
+	model := redblack.New(nnFactory)
+	r := rand.New(rand.NewSource(1))
+	randomOps(db, model, r, 5000)
+	checkModel(t, db, model)
+	if err := db.Close(); err != nil {
+		t.Fatalf("Unexpected error closing: %s", err)
+	}
+	stats := db.CompactionStats()
+	if stats.Compactions == 0 || stats.EntriesIn != stats.EntriesOut+stats.Shadowed+stats.TombstonesDropped {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+
+	db = openTestDB(t, dir, opts)
+	defer db.Close()
+	checkModel(t, db, model)
+	randomOps(db, model, r, 1000)
+	checkModel(t, db, model)
+}
+
+func TestLeveledCompaction(t *testing.T) {
+	testCompaction(t, &compaction.Leveled{L0Trigger: 2, BaseLevelSize: 2000})
+}
+
+func TestSizeTieredCompaction(t *testing.T) {
+	testCompaction(t, &compaction.SizeTiered{MinThreshold: 2})
+}
+
+func TestStrayTablesRemoved(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, smallOptions)
+	for i := 0; i < 1000; i++ {
+		db.Put(number(i), i)
+	}
+	db.Close()
+	tables, _ := filepath.Glob(filepath.Join(dir, "*"+tableSuffix))
+	if len(tables) != db.tableCount() {
+		t.Fatalf("Expected the compacted tables to be removed, got %d files for %d tables", len(tables), db.tableCount())
+	}
+	stray := filepath.Join(dir, fmt.Sprintf("%016x%s", 1<<40, tableSuffix))
+	if err := os.WriteFile(stray, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db = openTestDB(t, dir, smallOptions)
+	defer db.Close()
+	if _, err := os.Stat(stray); !os.IsNotExist(err) {
+		t.Fatalf("Expected the stray table to be removed")
+	}
+	if db.Len() != 1000 {
+		t.Fatalf("Expected 1000 keys, got %d", db.Len())
+	}
+}
+
+func TestCompactedTablesReleased(t *testing.T) {
+	opts := smallOptions
+	opts.Compaction = &compaction.Leveled{L0Trigger: 2, BaseLevelSize: 2000}
+	db := openTestDB(t, t.TempDir(), opts)
+	defer db.Close()
+	for i := 0; i < 500; i++ {
+		db.Put(number(i), i)
+	}
+	it := db.Range(smap.Interval{}).(*tableIterator)
+	held := it.tables
+	compacted := func() *table {
+		for _, table := range held {
+			if table.compacted.Load() {
+				return table
+			}
+		}
+		return nil
+	}
+	for i := 500; compacted() == nil; i++ {
+		db.Put(number(i), i)
+		if i > 100000 {
+			t.Fatalf("Expected the tables read by the iterator to be compacted")
+		}
+	}
+	victim := compacted()
+	//the compaction drops the DB references on its inputs holding the lock
+	db.mu.Lock()
+	db.mu.Unlock()
+	if _, err := os.Stat(victim.path); err != nil {
+		t.Fatalf("Expected a compacted table to be kept while read: %s", err)
+	}
+	n := 0
+	for ; it.Next(); n++ {
+	}
+	if n != 500 {
+		t.Fatalf("Expected the iterator to see the 500 keys it started with, got %d", n)
+	}
+	if _, err := os.Stat(victim.path); !os.IsNotExist(err) {
+		t.Fatalf("Expected the compacted table to be removed once released, got %v", err)
+	}
+	if refs := victim.refs.Load(); refs != 0 {
+		t.Fatalf("Expected the compacted table to be closed, it has %d references", refs)
+	}
+}
+
+func TestLogRemovedAfterFlush(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, smallOptions)
+	for i := 0; i < 1000; i++ {
+		db.Put(number(i), i)
+	}
+	db.Close()
+	segments, _ := filepath.Glob(filepath.Join(dir, "wal", "*"))
+	if len(segments) > 2 {
+		t.Fatalf("Expected flushed log segments to be removed, got %d segments", len(segments))
+	}
+}
+
+func TestDeletesFlush(t *testing.T) {
+	dir := t.TempDir()
+	opts := smallOptions
+	opts.Compaction = noCompaction{}
+	db := openTestDB(t, dir, opts)
+	defer db.Close()
+	for i := 0; i < 1000; i++ {
+		db.Delete(number(i))
+	}
+	if db.tableCount() == 0 {
+		t.Fatalf("Expected tombstones alone to fill and flush the memtable")
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if nodes := db.active.Nodes(); nodes >= 1000 {
+		t.Fatalf("Expected the active memtable to be frozen, it holds %d tombstones", nodes)
+	}
+}
+
+//seekFrom drains it after seeking key, starting with the element found.
+func seekFrom(it smap.Iterator, key smap.Key) string {
+	seeker := it.(smap.SeekableIterator)
+	if !seeker.Seek(key) {
+		return ""
+	}
+	return fmt.Sprintf("%v=%v ", seeker.Key(), seeker.Value()) + collect(seeker)
+}
+
+func TestSeekBackward(t *testing.T) {
+	opts := smallOptions
+	opts.Compaction = noCompaction{}
+	db := openTestDB(t, t.TempDir(), opts)
+	defer db.Close()
+	for k := 0; k < 10; k++ {
+		db.Put(number(k), k)
+	}
+	db.mu.Lock()
+	db.freeze()
+	for db.err == nil && len(db.frozen) > 0 {
+		db.flushed.Wait()
+	}
+	db.mu.Unlock()
+	if db.tableCount() != 1 {
+		t.Fatalf("Expected the keys to be flushed into a table, got %d tables", db.tableCount())
+	}
+	db.Put(number(3), 333)
+	db.Delete(number(4))
+
+	it := db.Range(smap.Interval{})
+	for it.Next() && it.Key().Cmp(number(8)) < 0 {
+	}
+	if expected, got := "2=2 3=333 5=5 6=6 7=7 8=8 9=9 ", seekFrom(it, number(2)); got != expected {
+		t.Fatalf("Expected Seek(2) to find %s, got %s", expected, got)
+	}
+	it = db.RangeReverse(smap.Interval{})
+	for it.Next() && it.Key().Cmp(number(1)) > 0 {
+	}
+	if expected, got := "7=7 6=6 5=5 3=333 2=2 1=1 0=0 ", seekFrom(it, number(7)); got != expected {
+		t.Fatalf("Expected a reverse Seek(7) to find %s, got %s", expected, got)
+	}
+}
+
+func TestApplyBatch(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, smallOptions)
+	b := &smap.Batch{}
+	for k := 0; k < 10; k++ {
+		b.Put(number(k), 0)
+	}
+	db.Apply(b)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i < 200; i++ {
+			b.Reset()
+			for k := 0; k < 10; k++ {
+				b.Put(number(k), i)
+			}
+			if err := db.Apply(b); err != nil {
+				t.Errorf("Unexpected error on Apply: %s", err)
+				break
+			}
+		}
+		close(done)
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		values := map[smap.Value]int{}
+		for it := db.Range(smap.Interval{}); it.Next(); {
+			values[it.Value()]++
+		}
+		if len(values) != 1 {
+			t.Fatalf("Expected every key to come from the same batch, got %v", values)
+		}
+	}
+	wg.Wait()
+	db.Close()
+
+	db = openTestDB(t, dir, smallOptions)
+	defer db.Close()
+	for k := 0; k < 10; k++ {
+		if v, _ := db.Get(number(k)); v != 199 {
+			t.Fatalf("Expected the last batch to be kept, got %v for %d", v, k)
+		}
+	}
+}
+
+func TestConcurrentReadWrite(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), smallOptions)
+	defer db.Close()
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				db.Put(number(w*1000+i), i)
+				if i%50 == 0 {
+					last := -1
+					for it := db.Range(smap.Interval{}); it.Next(); {
+						if k := int(it.Key().(number)); k <= last {
+							t.Errorf("Range out of order: %d after %d", k, last)
+							return
+						} else {
+							last = k
+						}
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if db.Len() != 2000 {
+		t.Fatalf("Expected 2000 keys, got %d", db.Len())
+	}
+}
@@ -0,0 +1,18 @@
+//Stork storage engine: a log-structured sorted map.
+//Writes are appended to a write-ahead log and applied to an in-memory RedBlack (the memtable).
+//Once the memtable grows past Options.MemtableSize it is frozen and a background goroutine
+//flushes it into an immutable table, after which its log segments are removed.
+//Reads look at the memtable, the frozen memtables and the tables, newest first,
+//so deletions are kept as tombstones until nothing older can be shadowed.
+//
+//Another goroutine compacts the tables as chosen by Options.Compaction. The live tables,
+//along with their level and recency, are listed in a MANIFEST file: table files missing
+//from it are leftovers from an interrupted flush or compaction and are removed on Open.
+//The MANIFEST also records the first log segment not flushed yet, so segments a crash left
+//behind are not replayed twice, and the format of the table values.
+//
+//With Options.Merge, DB.Merge stores read-modify-write operands (see smap.MergeOperator)
+//instead of values. They are applied when the key is read, and folded into the values
+//they apply to, or into each other, when memtables are flushed and tables compacted.
+//The tables of a DB with Options.Merge can't be opened without it, and vice versa.
+package stork
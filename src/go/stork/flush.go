@@ -0,0 +1,60 @@
+package stork
+
+import (
+	"github.com/losmonos/stork/src/go/sstable"
+)
+
+//flusher writes the frozen memtables into tables, oldest first, until the DB is closed.
+//Every flush wakes up the compactor, which stops along with the flusher.
+func (db *DB) flusher() {
+	defer db.wg.Done()
+	defer close(db.compact)
+	for range db.flush {
+		for db.flushOldest() {
+			select {
+			case db.compact <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+//flushOldest writes the oldest frozen memtable into a new level 0 table and drops its log segments.
+//It returns false when there's nothing left to flush or the flush failed.
+func (db *DB) flushOldest() bool {
+	db.mu.Lock()
+	if db.err != nil || len(db.frozen) == 0 {
+		db.mu.Unlock()
+		return false
+	}
+	m := db.frozen[len(db.frozen)-1]
+	id := db.nextID
+	db.nextID++
+	db.mu.Unlock()
+
+	path := db.tablePath(id)
+	err := sstable.Flush(path, m.RedBlack, db.opts.Table)
+	var t *table
+	if err == nil {
+		t, err = db.openTable(id, 0, id)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if err == nil {
+		if err = db.install(append([]*table{t}, db.tables...), m.segment); err != nil {
+			t.unref()
+		}
+	}
+	if err != nil {
+		db.fail(err)
+		return false
+	}
+	db.frozen = db.frozen[:len(db.frozen)-1]
+	db.flushed.Broadcast()
+	if err := db.log.RemoveBefore(m.segment); err != nil {
+		db.fail(err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package stork
+
+import (
+	"github.com/losmonos/stork/src/go/smap"
+	"runtime"
+	"sort"
+)
+
+//copiedEntry is an entry copied out of a layer.
+type copiedEntry struct {
+	key       smap.Key
+	value     smap.Value
+	tombstone bool
+}
+
+//sliceIterator iterates over copied entries, in descending order if reverse is set.
+//It implements smap.TombstoneIterator and smap.SeekableIterator.
+type sliceIterator struct {
+	entries []copiedEntry
+	pos     int
+	reverse bool
+}
+
+//copyIterator drains an iterator into a sliceIterator, so it no longer depends on its source.
+//reverse tells whether the iterator yields its keys in descending order.
+func copyIterator(it smap.TombstoneIterator, reverse bool) *sliceIterator {
+	s := &sliceIterator{pos: -1, reverse: reverse}
+	for it.Next() {
+		e := copiedEntry{key: it.Key(), tombstone: it.Tombstone()}
+		if !e.tombstone {
+			e.value = it.Value()
+		}
+		s.entries = append(s.entries, e)
+	}
+	return s
+}
+
+//Next advances the iterator one step and if returns true, an entry will be available upon calling Key() and Value()
+func (s *sliceIterator) Next() bool {
+	if s.pos < len(s.entries) {
+		s.pos++
+	}
+	return s.pos < len(s.entries)
+}
+
+//Seek repositions the iterator with a binary search over the entries, see smap.SeekableIterator.
+func (s *sliceIterator) Seek(key smap.Key) bool {
+	s.pos = sort.Search(len(s.entries), func(i int) bool {
+		if s.reverse {
+			return s.entries[i].key.Cmp(key) <= 0
+		}
+		return s.entries[i].key.Cmp(key) >= 0
+	})
+	return s.pos < len(s.entries)
+}
+
+//Key returns the current key in the iterator.
+func (s *sliceIterator) Key() smap.Key {
+	return s.entries[s.pos].key
+}
+
+//Value returns the current value in the iterator.
+func (s *sliceIterator) Value() smap.Value {
+	return s.entries[s.pos].value
+}
+
+//Tombstone tells whether the current entry is a tombstone.
+func (s *sliceIterator) Tombstone() bool {
+	return s.entries[s.pos].tombstone
+}
+
+//tableIterator is a DB iterator, which holds a reference on the tables it reads
+//until it's closed or exhausted. Seeking after that finds nothing.
+type tableIterator struct {
+	*smap.MergeIterator
+	tables []*table
+}
+
+//newTableIterator wraps a merged iterator reading tables, which must be referenced already.
+//The references are dropped by a finalizer if the iterator is abandoned.
+func newTableIterator(merged *smap.MergeIterator, tables []*table) *tableIterator {
+	it := &tableIterator{merged, tables}
+	runtime.SetFinalizer(it, (*tableIterator).release)
+	return it
+}
+
+//release drops the references on the tables, once.
+func (t *tableIterator) release() {
+	for _, table := range t.tables {
+		table.unref()
+	}
+	t.tables = nil
+}
+
+//Next advances the iterator one step and if returns true, an entry will be available upon calling Key() and Value()
+func (t *tableIterator) Next() bool {
+	if t.tables == nil || !t.MergeIterator.Next() {
+		t.release()
+		return false
+	}
+	return true
+}
+
+//Seek repositions the iterator, see smap.SeekableIterator.
+func (t *tableIterator) Seek(key smap.Key) bool {
+	if t.tables == nil || !t.MergeIterator.Seek(key) {
+		t.release()
+		return false
+	}
+	return true
+}
+
+//Close closes the sources and releases the tables.
+func (t *tableIterator) Close() error {
+	err := t.MergeIterator.Close()
+	t.release()
+	return err
+}
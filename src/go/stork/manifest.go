@@ -0,0 +1,84 @@
+package stork
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+//manifestName is the file listing the live tables.
+const manifestName = "MANIFEST"
+
+//manifestTable is the manifest record of a table.
+type manifestTable struct {
+	ID    uint64 `json:"id"`
+	Level int    `json:"level"`
+	Seq   uint64 `json:"seq"`
+}
+
+//manifest lists the live tables, along with their level and recency.
+//Table files missing from it are leftovers from an interrupted flush or compaction.
+//LogFrom is the first log segment with records not flushed into the tables: the older ones
+//are not replayed, even if the DB crashed before removing them.
+//Format is the format of the table values, which depends on Options.Merge.
+type manifest struct {
+	Tables  []manifestTable `json:"tables"`
+	LogFrom uint64          `json:"log_from"`
+	Format  string          `json:"format"`
+}
+
+//Table value formats: plain values, or values and smap.Operands tagged by operandCodec.
+const (
+	formatValues   = "values"
+	formatOperands = "operands"
+)
+
+//readManifest loads the manifest in dir. found is false if there's none yet.
+func readManifest(dir string) (m manifest, found bool, err error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if os.IsNotExist(err) {
+		return m, false, nil
+	}
+	if err != nil {
+		return m, false, err
+	}
+	return m, true, json.Unmarshal(data, &m)
+}
+
+//writeManifest atomically replaces the manifest in dir.
+func writeManifest(dir string, m manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, manifestName)
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(dir)
+}
+
+//syncDir fsyncs a directory, so renamed files survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
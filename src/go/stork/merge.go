@@ -0,0 +1,156 @@
+package stork
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/smap/redblack"
+	"github.com/losmonos/stork/src/go/sstable"
+	"github.com/losmonos/stork/src/go/wal"
+)
+
+//errNoMerge is returned by Merge on a DB without a MergeOperator.
+var errNoMerge = fmt.Errorf("stork: Merge on a DB without a MergeOperator")
+
+//Merge stores a merge operand for key, to be applied by Options.Merge to the value of the key
+//when it's read. It fails if the DB has no MergeOperator.
+func (db *DB) Merge(key smap.Key, operand smap.Value) error {
+	if db.opts.Merge == nil {
+		return errNoMerge
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.write(wal.Record{Op: wal.OpMerge, Key: key, Value: operand})
+}
+
+//applyMerge stores a merge operand in the active memtable.
+//Operands on a key deleted in the memtable are merged right away, as there's nothing older to apply them to.
+func (db *DB) applyMerge(key smap.Key, operand smap.Value) {
+	if _, deleted, found := db.active.Lookup(key); found && deleted {
+		db.active.Put(key, db.opts.Merge.FullMerge(key, nil, false, []smap.Value{operand}))
+		return
+	}
+	db.active.Put(key, smap.Operands{operand})
+}
+
+//mergeEntry is the memtable entry of a DB with a MergeOperator: the user entry, if the value
+//of the key is known, followed by the operands merged since.
+type mergeEntry struct {
+	key      smap.Key
+	base     redblack.Entry
+	operands smap.Operands
+	db       *DB
+}
+
+//mergeFactory builds mergeEntries, holding either a value or smap.Operands.
+func (db *DB) mergeFactory(key smap.Key, value smap.Value) redblack.Entry {
+	e := &mergeEntry{key: key, db: db}
+	e.SetValue(value)
+	return e
+}
+
+//GetKey returns the entry key.
+func (e *mergeEntry) GetKey() smap.Key {
+	return e.key
+}
+
+//SetValue appends operands, or replaces the value dropping the pending operands.
+func (e *mergeEntry) SetValue(v smap.Value) {
+	if operands, ok := v.(smap.Operands); ok {
+		e.operands = append(e.operands, operands...)
+		return
+	}
+	if e.base == nil {
+		e.base = e.db.opts.Factory(e.key, v)
+	} else {
+		e.base.SetValue(v)
+	}
+	e.operands = nil
+}
+
+//GetValue merges the operands into the value. Without a value, the operands are
+//returned folded as smap.Operands, to be resolved against the older layers.
+func (e *mergeEntry) GetValue() smap.Value {
+	if e.base == nil {
+		return e.operands.Fold(e.db.opts.Merge, e.key)
+	}
+	if len(e.operands) == 0 {
+		return e.base.GetValue()
+	}
+	return e.db.opts.Merge.FullMerge(e.key, e.base.GetValue(), true, e.operands)
+}
+
+//operandSize is the estimated size of an operand, which the DB knows nothing about.
+const operandSize = 16
+
+//Size returns the size of the value plus an estimate for the operands.
+func (e *mergeEntry) Size() int {
+	size := len(e.operands) * operandSize
+	if e.base != nil {
+		size += e.base.Size()
+	}
+	return size
+}
+
+//Empty tells whether the entry holds nothing.
+func (e *mergeEntry) Empty() bool {
+	return e.base == nil && len(e.operands) == 0
+}
+
+//operandCodec tags the table values of a DB with a MergeOperator as either values or
+//smap.Operands, encoding each operand with the user codec.
+type operandCodec struct {
+	smap.ValueCodec
+}
+
+const (
+	tagValue    = 0
+	tagOperands = 1
+)
+
+//EncodeValue encodes a value or smap.Operands.
+func (c operandCodec) EncodeValue(v smap.Value) ([]byte, error) {
+	operands, ok := v.(smap.Operands)
+	if !ok {
+		encoded, err := c.ValueCodec.EncodeValue(v)
+		return append([]byte{tagValue}, encoded...), err
+	}
+	buf := binary.AppendUvarint([]byte{tagOperands}, uint64(len(operands)))
+	for _, operand := range operands {
+		encoded, err := c.ValueCodec.EncodeValue(operand)
+		if err != nil {
+			return nil, err
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(encoded)))
+		buf = append(buf, encoded...)
+	}
+	return buf, nil
+}
+
+//DecodeValue decodes a value or smap.Operands.
+func (c operandCodec) DecodeValue(b []byte) (smap.Value, error) {
+	if len(b) == 0 {
+		return nil, sstable.ErrCorrupt
+	}
+	if b[0] == tagValue {
+		return c.ValueCodec.DecodeValue(b[1:])
+	}
+	count, n := binary.Uvarint(b[1:])
+	if b[0] != tagOperands || n <= 0 || count > uint64(len(b)) {
+		return nil, sstable.ErrCorrupt
+	}
+	b = b[1+n:]
+	operands := make(smap.Operands, count)
+	for i := range operands {
+		length, n := binary.Uvarint(b)
+		if n <= 0 || uint64(len(b)-n) < length {
+			return nil, sstable.ErrCorrupt
+		}
+		operand, err := c.ValueCodec.DecodeValue(b[n : n+int(length)])
+		if err != nil {
+			return nil, err
+		}
+		operands[i], b = operand, b[n+int(length):]
+	}
+	return operands, nil
+}
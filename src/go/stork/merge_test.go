@@ -0,0 +1,141 @@
+package stork
+
+import (
+	"fmt"
+	"github.com/losmonos/stork/src/go/compaction"
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/smap/redblack"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//add is a counter MergeOperator for int values.
+var add = smap.Associative(func(key smap.Key, older, newer smap.Value) smap.Value { return older.(int) + newer.(int) })
+
+//randomMerges applies random puts, deletes and additions to the DB and to a reference RedBlack.
+func randomMerges(db *DB, model *redblack.RedBlack, r *rand.Rand, n int) {
+	for i := 0; i < n; i++ {
+		k := number(r.Intn(500))
+		switch r.Intn(6) {
+		case 0:
+			db.Delete(k)
+			model.Delete(k)
+		case 1:
+			db.Put(k, i)
+			model.Put(k, i)
+		default:
+			db.Merge(k, i)
+			v, _ := model.Get(k)
+			if v == nil {
+				v = 0
+			}
+			model.Put(k, v.(int)+i)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	opts := smallOptions
+	opts.Merge = add
+	opts.Compaction = &compaction.Leveled{L0Trigger: 2, BaseLevelSize: 2000}
+	opts.TableSize = 16 * 20
+	db := openTestDB(t, dir, opts)
+	model := redblack.New(nnFactory)
+	r := rand.New(rand.NewSource(1))
+	randomMerges(db, model, r, 5000)
+	checkModel(t, db, model)
+	if err := db.Close(); err != nil {
+		t.Fatalf("Unexpected error closing: %s", err)
+	}
+	if db.CompactionStats().Compactions == 0 {
+		t.Fatalf("Expected the tables to be compacted")
+	}
+
+	db = openTestDB(t, dir, opts)
+	checkModel(t, db, model)
+	randomMerges(db, model, r, 1000)
+	checkModel(t, db, model)
+	db.Close()
+
+	opts.Merge = nil
+	if db, err := Open(dir, opts); err == nil {
+		db.Close()
+		t.Fatalf("Expected the merges in the log to require a MergeOperator")
+	}
+}
+
+func TestMergeReplayedOnce(t *testing.T) {
+	dir := t.TempDir()
+	opts := smallOptions
+	opts.Merge = add
+	opts.Compaction = noCompaction{}
+	db := openTestDB(t, dir, opts)
+	db.Merge(number(1000), 1)
+	//keep the segment holding the merge, as if the DB crashed before removing it
+	segments, _ := filepath.Glob(filepath.Join(dir, "wal", "*"))
+	saved := map[string][]byte{}
+	for _, segment := range segments {
+		saved[segment], _ = os.ReadFile(segment)
+	}
+	for i := 0; i < 500; i++ {
+		db.Put(number(i), i)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Unexpected error closing: %s", err)
+	}
+	if db.tableCount() == 0 {
+		t.Fatalf("Expected the merge to be flushed")
+	}
+	for segment, data := range saved {
+		if _, err := os.Stat(segment); err == nil {
+			t.Fatalf("Expected the flushed segment %s to be removed", segment)
+		}
+		os.WriteFile(segment, data, 0644)
+	}
+	db = openTestDB(t, dir, opts)
+	defer db.Close()
+	if v, _ := db.Get(number(1000)); v != 1 {
+		t.Fatalf("Expected the merge to be applied once, got %v", v)
+	}
+}
+
+func TestMergeFormat(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, smallOptions)
+	if err := db.Merge(number(1), 1); err == nil {
+		t.Fatalf("Expected Merge to fail without a MergeOperator")
+	}
+	db.Put(number(1), 1)
+	db.Close()
+	opts := smallOptions
+	opts.Merge = add
+	if db, err := Open(dir, opts); err == nil {
+		db.Close()
+		t.Fatalf("Expected a DB without a MergeOperator not to be opened with one")
+	}
+	db = openTestDB(t, dir, smallOptions)
+	defer db.Close()
+	if v, _ := db.Get(number(1)); v != 1 {
+		t.Fatalf("Expected 1, got %v", v)
+	}
+}
+
+func TestMergeCodec(t *testing.T) {
+	codec := operandCodec{nnCodec{}}
+	for _, v := range []smap.Value{7, smap.Operands{1, -2, 300}, smap.Operands{}} {
+		encoded, err := codec.EncodeValue(v)
+		if err != nil {
+			t.Fatalf("Unexpected error encoding %v: %s", v, err)
+		}
+		decoded, err := codec.DecodeValue(encoded)
+		if err != nil || fmt.Sprint(decoded) != fmt.Sprint(v) {
+			t.Fatalf("Expected %v, got %v, %v", v, decoded, err)
+		}
+	}
+	if _, err := codec.DecodeValue([]byte{tagOperands, 2, 1}); err == nil {
+		t.Fatalf("Expected truncated operands to fail")
+	}
+}
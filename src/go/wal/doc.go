@@ -0,0 +1,18 @@
+//Write-ahead log for sorted maps.
+//Every Put() and Delete() is appended to a segment file as a checksummed,
+//length-prefixed record before it is applied to the in-memory map,
+//so the map can be rebuilt by replaying the log after a restart or a crash.
+//
+//Segment files are named after their sequence number and are rotated once they
+//grow past Options.SegmentSize. Each record is laid out as:
+//
+//	crc32c(payload) uint32 | len(payload) uint32 | payload
+//
+//where payload is the operation byte, the uvarint length of the encoded key,
+//the key and, for puts and merges, the encoded value or merge operand. Batch records hold the operation byte
+//followed by the whole batch as encoded by smap.Batch.Marshal, so they are replayed
+//all or nothing.
+//A partially written record at the end of the last segment (a torn tail) is
+//truncated when the log is opened. A bad record followed by valid ones is reported
+//as ErrCorrupt instead, wherever it is.
+package wal
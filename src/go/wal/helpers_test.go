@@ -0,0 +1,13 @@
+//Helpers for testing the log with string keys and values, see fixtures.
+package wal
+
+import (
+	"github.com/losmonos/stork/src/go/internal/fixtures"
+)
+
+type (
+	str      = fixtures.Str
+	strCodec = fixtures.StrCodec
+)
+
+var ssFactory = fixtures.SSFactory
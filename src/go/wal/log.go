@@ -0,0 +1,376 @@
+package wal
+
+import (
+	"fmt"
+	"github.com/losmonos/stork/src/go/smap"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//SyncPolicy tells when appended records are flushed to stable storage.
+//Records are always handed to the operating system as soon as they are appended,
+//so only a machine crash can lose the records which were not synced yet.
+type SyncPolicy int
+
+const (
+	//SyncAlways fsyncs after every record.
+	SyncAlways SyncPolicy = iota
+	//SyncBatch fsyncs once every Options.BatchSize records.
+	SyncBatch
+	//SyncInterval fsyncs from a background goroutine every Options.Interval.
+	SyncInterval
+)
+
+const (
+	DefaultBatchSize   = 64
+	DefaultInterval    = 100 * time.Millisecond
+	DefaultSegmentSize = 4 << 20
+)
+
+//Options configures a Log. Codec is mandatory, zero values elsewhere pick the defaults.
+type Options struct {
+	Codec       smap.Codec
+	Sync        SyncPolicy
+	BatchSize   int
+	Interval    time.Duration
+	SegmentSize int64
+}
+
+//withDefaults fills in the unset options.
+func (o Options) withDefaults() Options {
+	if o.BatchSize <= 0 {
+		o.BatchSize = DefaultBatchSize
+	}
+	if o.Interval <= 0 {
+		o.Interval = DefaultInterval
+	}
+	if o.SegmentSize <= 0 {
+		o.SegmentSize = DefaultSegmentSize
+	}
+	return o
+}
+
+//Log is an append only sequence of records split in segment files.
+//It is safe for concurrent use.
+type Log struct {
+	dir       string
+	opts      Options
+	mu        sync.Mutex
+	file      *os.File
+	segment   uint64
+	size      int64
+	unsynced  int
+	recovered []uint64
+	done      chan struct{}
+	wg        sync.WaitGroup
+	err       error
+}
+
+//segmentSuffix is the file extension of the log segments.
+const segmentSuffix = ".wal"
+
+//segmentName returns the file name for a segment number.
+func segmentName(segment uint64) string {
+	return fmt.Sprintf("%016x%s", segment, segmentSuffix)
+}
+
+//listSegments returns the segment numbers found in dir, in ascending order.
+func listSegments(dir string) ([]uint64, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]uint64, 0, len(names))
+	for _, name := range names {
+		base := strings.TrimSuffix(filepath.Base(name), segmentSuffix)
+		if segment, err := strconv.ParseUint(base, 16, 64); err == nil {
+			segments = append(segments, segment)
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+//Open opens the log stored in dir, creating it if needed.
+//A torn tail in the last segment is truncated, the records before it are kept for Replay().
+//New records are always appended to a fresh segment.
+func Open(dir string, opts Options) (*Log, error) {
+	if opts.Codec == nil {
+		return nil, fmt.Errorf("wal: no Codec given")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{dir: dir, opts: opts.withDefaults(), recovered: segments}
+	if len(segments) > 0 {
+		last := segments[len(segments)-1]
+		if err := l.truncateTornTail(last); err != nil {
+			return nil, err
+		}
+		l.segment = last
+	}
+	if err := l.openSegment(l.segment + 1); err != nil {
+		return nil, err
+	}
+	if l.opts.Sync == SyncInterval {
+		l.done = make(chan struct{})
+		l.wg.Add(1)
+		go l.syncEvery(l.opts.Interval, l.done)
+	}
+	return l, nil
+}
+
+//truncateTornTail cuts a segment after its last complete record.
+//A bad record followed by a valid one is not a torn write but corruption, and ErrCorrupt is returned.
+func (l *Log) truncateTornTail(segment uint64) error {
+	path := filepath.Join(l.dir, segmentName(segment))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	offset := 0
+	for offset < len(data) {
+		_, n, err := nextRecord(data[offset:])
+		if err != nil {
+			break
+		}
+		offset += n
+	}
+	if offset == len(data) {
+		return nil
+	}
+	if followedByRecord(data[offset:]) {
+		return fmt.Errorf("%w: segment %d offset %d", ErrCorrupt, segment, offset)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := file.Truncate(int64(offset)); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+//openSegment creates a new segment and makes it the current one.
+func (l *Log) openSegment(segment uint64) error {
+	file, err := os.OpenFile(filepath.Join(l.dir, segmentName(segment)), os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if err := syncDir(l.dir); err != nil {
+		file.Close()
+		return err
+	}
+	l.file, l.segment, l.size, l.unsynced = file, segment, 0, 0
+	return nil
+}
+
+//syncDir fsyncs a directory, so newly created files survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+//Replay calls apply for every record that was in the log when it was opened, in order.
+//It returns ErrCorrupt if a record in the middle of the log fails its checksum,
+//or the first error returned by apply.
+func (l *Log) Replay(apply func(Record) error) error {
+	for _, segment := range l.recovered {
+		data, err := os.ReadFile(filepath.Join(l.dir, segmentName(segment)))
+		if err != nil {
+			return err
+		}
+		for offset := 0; offset < len(data); {
+			payload, n, err := nextRecord(data[offset:])
+			if err != nil {
+				return fmt.Errorf("%w: segment %d offset %d", ErrCorrupt, segment, offset)
+			}
+			record, err := decode(payload, l.opts.Codec)
+			if err != nil {
+				return err
+			}
+			if err := apply(record); err != nil {
+				return err
+			}
+			offset += n
+		}
+	}
+	return nil
+}
+
+//Put appends a put record.
+func (l *Log) Put(key smap.Key, value smap.Value) error {
+	return l.Append(Record{Op: OpPut, Key: key, Value: value})
+}
+
+//Delete appends a delete record.
+func (l *Log) Delete(key smap.Key) error {
+	return l.Append(Record{Op: OpDelete, Key: key})
+}
+
+//Batch appends a record holding a whole batch, so it's replayed all or nothing.
+func (l *Log) Batch(b *smap.Batch) error {
+	return l.Append(Record{Op: OpBatch, Batch: b})
+}
+
+//Append writes a record to the log and syncs it according to the sync policy.
+//Once a write or sync fails the log stops accepting records and keeps returning the error.
+func (l *Log) Append(r Record) error {
+	buf, err := r.encode(l.opts.Codec)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+	if l.size > 0 && l.size+int64(len(buf)) > l.opts.SegmentSize {
+		if l.err = l.rotate(); l.err != nil {
+			return l.err
+		}
+	}
+	if _, l.err = l.file.Write(buf); l.err != nil {
+		return l.err
+	}
+	l.size += int64(len(buf))
+	l.unsynced++
+	switch l.opts.Sync {
+	case SyncAlways:
+		l.err = l.sync()
+	case SyncBatch:
+		if l.unsynced >= l.opts.BatchSize {
+			l.err = l.sync()
+		}
+	}
+	return l.err
+}
+
+//Rotate closes the current segment and starts a new one, returning the new segment number.
+//Records appended afterwards are known to be in segments >= the returned one.
+func (l *Log) Rotate() (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return 0, l.err
+	}
+	l.err = l.rotate()
+	return l.segment, l.err
+}
+
+//RemoveBefore deletes all the segments older than segment, once their records are stored elsewhere.
+//The current segment is never removed. Removed segments are not replayed.
+func (l *Log) RemoveBefore(segment uint64) error {
+	l.mu.Lock()
+	current := l.segment
+	for len(l.recovered) > 0 && l.recovered[0] < segment {
+		l.recovered = l.recovered[1:]
+	}
+	l.mu.Unlock()
+	segments, err := listSegments(l.dir)
+	if err != nil {
+		return err
+	}
+	for _, s := range segments {
+		if s >= segment || s >= current {
+			break
+		}
+		if err := os.Remove(filepath.Join(l.dir, segmentName(s))); err != nil {
+			return err
+		}
+	}
+	return syncDir(l.dir)
+}
+
+//rotate closes the current segment and starts a new one.
+func (l *Log) rotate() error {
+	if err := l.sync(); err != nil {
+		return err
+	}
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	return l.openSegment(l.segment + 1)
+}
+
+//sync fsyncs the current segment if there's anything pending.
+func (l *Log) sync() error {
+	if l.unsynced == 0 {
+		return nil
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.unsynced = 0
+	return nil
+}
+
+//Sync flushes all the appended records to stable storage.
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+	l.err = l.sync()
+	return l.err
+}
+
+//syncEvery runs the SyncInterval policy until the log is closed.
+func (l *Log) syncEvery(interval time.Duration, done chan struct{}) {
+	defer l.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.Sync()
+		case <-done:
+			return
+		}
+	}
+}
+
+//Close syncs and closes the log. The log can't be used afterwards.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	done := l.done
+	l.done = nil
+	l.mu.Unlock()
+	if done != nil {
+		close(done)
+		l.wg.Wait()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return l.err
+	}
+	err := l.err
+	if err == nil {
+		err = l.sync()
+	}
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	if l.err == nil {
+		l.err = fmt.Errorf("wal: log closed")
+	}
+	return err
+}
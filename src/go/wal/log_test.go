@@ -0,0 +1,276 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/smap/redblack"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testOptions = Options{Codec: strCodec{}}
+
+func openTestMemtable(t *testing.T, dir string, opts Options) *Memtable {
+	m, err := OpenMemtable(dir, redblack.New(ssFactory), opts)
+	if err != nil {
+		t.Fatalf("Unexpected error opening memtable: %s", err)
+	}
+	return m
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	m := openTestMemtable(t, dir, testOptions)
+	for _, word := range []string{"blueberry", "cherry", "lemon", "orange"} {
+		if err := m.Put(str(word), word); err != nil {
+			t.Fatalf("Unexpected error on Put: %s", err)
+		}
+	}
+	m.Put(str("lemon"), "lime")
+	if _, _, err := m.Delete(str("cherry")); err != nil {
+		t.Fatalf("Unexpected error on Delete: %s", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("Unexpected error on Close: %s", err)
+	}
+
+	m = openTestMemtable(t, dir, testOptions)
+	defer m.Close()
+	if m.Len() != 3 {
+		t.Fatalf("Expected 3 keys after replay, got %d", m.Len())
+	}
+	if v, found := m.Get(str("lemon")); !found || v != "lime" {
+		t.Fatalf("Expected 'lime' for 'lemon', got %q", v)
+	}
+	if v, found := m.Get(str("cherry")); found {
+		t.Fatalf("Expected 'cherry' to be deleted, got %q", v)
+	}
+}
+
+func TestReplayMerge(t *testing.T) {
+	dir := t.TempDir()
+	log, err := Open(dir, testOptions)
+	if err != nil {
+		t.Fatalf("Unexpected error opening the log: %s", err)
+	}
+	if err := log.Append(Record{Op: OpMerge, Key: str("lemon"), Value: "lime"}); err != nil {
+		t.Fatalf("Unexpected error on Append: %s", err)
+	}
+	log.Close()
+	if _, err := OpenMemtable(dir, redblack.New(ssFactory), testOptions); err == nil {
+		t.Fatalf("Expected an error replaying a merge on a Memtable")
+	}
+}
+
+func TestTornTail(t *testing.T) {
+	dir := t.TempDir()
+	m := openTestMemtable(t, dir, testOptions)
+	m.Put(str("lemon"), "lemon")
+	m.Put(str("orange"), "orange")
+	m.Close()
+
+	segments, _ := listSegments(dir)
+	path := filepath.Join(dir, segmentName(segments[len(segments)-1]))
+	info, _ := os.Stat(path)
+	//chop the last record in half
+	if err := os.Truncate(path, info.Size()-4); err != nil {
+		t.Fatal(err)
+	}
+	m = openTestMemtable(t, dir, testOptions)
+	if v, found := m.Get(str("lemon")); !found || v != "lemon" {
+		t.Fatalf("Expected 'lemon' to survive the torn tail, got %q", v)
+	}
+	if v, found := m.Get(str("orange")); found {
+		t.Fatalf("Expected torn 'orange' to be dropped, got %q", v)
+	}
+	m.Put(str("pear"), "pear")
+	m.Close()
+
+	m = openTestMemtable(t, dir, testOptions)
+	defer m.Close()
+	if m.Len() != 2 {
+		t.Fatalf("Expected 2 keys after recovering a torn tail, got %d", m.Len())
+	}
+}
+
+//writeBatch logs a put of lemon and a batch replacing it with orange and pear.
+func writeBatch(t *testing.T, dir string) {
+	m := openTestMemtable(t, dir, testOptions)
+	defer m.Close()
+	m.Put(str("lemon"), "lemon")
+	b := &smap.Batch{}
+	b.Put(str("orange"), "orange")
+	b.Delete(str("lemon"))
+	b.Put(str("pear"), "pear")
+	if err := m.Apply(b); err != nil {
+		t.Fatalf("Unexpected error on Apply: %s", err)
+	}
+	if m.Len() != 2 {
+		t.Fatalf("Expected 2 keys after the batch, got %d", m.Len())
+	}
+}
+
+func TestBatchAllOrNothing(t *testing.T) {
+	dir := t.TempDir()
+	writeBatch(t, dir)
+	m := openTestMemtable(t, dir, testOptions)
+	if _, found := m.Get(str("lemon")); found || m.Len() != 2 {
+		t.Fatalf("Expected the batch to be replayed, got %d keys", m.Len())
+	}
+	m.Close()
+
+	dir = t.TempDir()
+	writeBatch(t, dir)
+	segments, _ := listSegments(dir)
+	path := filepath.Join(dir, segmentName(segments[len(segments)-1]))
+	info, _ := os.Stat(path)
+	//chop the batch record, the last one, in half
+	if err := os.Truncate(path, info.Size()-4); err != nil {
+		t.Fatal(err)
+	}
+	m = openTestMemtable(t, dir, testOptions)
+	defer m.Close()
+	if v, found := m.Get(str("lemon")); !found || v != "lemon" || m.Len() != 1 {
+		t.Fatalf("Expected none of the torn batch to be replayed, got %d keys", m.Len())
+	}
+}
+
+func TestCorruptMiddle(t *testing.T) {
+	dir := t.TempDir()
+	m := openTestMemtable(t, dir, testOptions)
+	m.Put(str("lemon"), "lemon")
+	m.Close()
+	m = openTestMemtable(t, dir, testOptions)
+	m.Put(str("orange"), "orange")
+	m.Close()
+
+	segments, _ := listSegments(dir)
+	path := filepath.Join(dir, segmentName(segments[0]))
+	data, _ := os.ReadFile(path)
+	data[len(data)-1] ^= 0xff
+	os.WriteFile(path, data, 0644)
+	if _, err := OpenMemtable(dir, redblack.New(ssFactory), testOptions); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Expected ErrCorrupt, got %v", err)
+	}
+}
+
+func TestCorruptMiddleOfLastSegment(t *testing.T) {
+	dir := t.TempDir()
+	m := openTestMemtable(t, dir, testOptions)
+	m.Put(str("lemon"), "lemon")
+	m.Put(str("orange"), "orange")
+	m.Put(str("pear"), "pear")
+	m.Close()
+
+	segments, _ := listSegments(dir)
+	path := filepath.Join(dir, segmentName(segments[len(segments)-1]))
+	data, _ := os.ReadFile(path)
+	//flip a byte of the first record payload, the records after it are still valid
+	data[headerSize+2] ^= 0xff
+	os.WriteFile(path, data, 0644)
+	if _, err := OpenMemtable(dir, redblack.New(ssFactory), testOptions); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Expected ErrCorrupt, got %v", err)
+	}
+	if info, _ := os.Stat(path); info.Size() != int64(len(data)) {
+		t.Fatalf("Expected the corrupt segment to be left untouched, got %d bytes out of %d", info.Size(), len(data))
+	}
+}
+
+func TestSegmentRotation(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions
+	opts.SegmentSize = 64
+	m := openTestMemtable(t, dir, opts)
+	for i := 0; i < 100; i++ {
+		m.Put(str(fmt.Sprintf("key%03d", i)), fmt.Sprint(i))
+	}
+	m.Close()
+	if segments, _ := listSegments(dir); len(segments) < 10 {
+		t.Fatalf("Expected the log to be rotated, got %d segments", len(segments))
+	}
+	m = openTestMemtable(t, dir, opts)
+	defer m.Close()
+	if m.Len() != 100 {
+		t.Fatalf("Expected 100 keys after replay, got %d", m.Len())
+	}
+}
+
+func TestSyncPolicies(t *testing.T) {
+	for _, policy := range []SyncPolicy{SyncAlways, SyncBatch, SyncInterval} {
+		dir := t.TempDir()
+		opts := Options{Codec: strCodec{}, Sync: policy, BatchSize: 3, Interval: time.Millisecond}
+		m := openTestMemtable(t, dir, opts)
+		for i := 0; i < 10; i++ {
+			if err := m.Put(str(fmt.Sprint(i)), "v"); err != nil {
+				t.Fatalf("Unexpected error with policy %d: %s", policy, err)
+			}
+		}
+		if policy == SyncInterval {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if err := m.Close(); err != nil {
+			t.Fatalf("Unexpected error closing with policy %d: %s", policy, err)
+		}
+		if err := m.Put(str("late"), "v"); err == nil {
+			t.Fatalf("Expected an error writing to a closed log with policy %d", policy)
+		}
+	}
+}
+
+func TestRotateAndRemove(t *testing.T) {
+	dir := t.TempDir()
+	log, err := Open(dir, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Put(str("lemon"), "lemon")
+	segment, err := log.Rotate()
+	if err != nil {
+		t.Fatalf("Unexpected error rotating: %s", err)
+	}
+	log.Put(str("orange"), "orange")
+	if err := log.RemoveBefore(segment); err != nil {
+		t.Fatalf("Unexpected error removing segments: %s", err)
+	}
+	log.Close()
+
+	m := openTestMemtable(t, dir, testOptions)
+	defer m.Close()
+	if _, found := m.Get(str("lemon")); found {
+		t.Fatalf("Expected 'lemon' to be removed along with its segment")
+	}
+	if _, found := m.Get(str("orange")); !found {
+		t.Fatalf("Expected 'orange' to be replayed")
+	}
+}
+
+func TestRemoveBeforeReplay(t *testing.T) {
+	dir := t.TempDir()
+	log, err := Open(dir, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Put(str("lemon"), "lemon")
+	segment, _ := log.Rotate()
+	log.Put(str("orange"), "orange")
+	log.Close()
+
+	log, err = Open(dir, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	if err := log.RemoveBefore(segment); err != nil {
+		t.Fatalf("Unexpected error removing segments: %s", err)
+	}
+	replayed := []smap.Key{}
+	if err := log.Replay(func(r Record) error { replayed = append(replayed, r.Key); return nil }); err != nil {
+		t.Fatalf("Unexpected error replaying: %s", err)
+	}
+	if len(replayed) != 1 || replayed[0] != str("orange") {
+		t.Fatalf("Expected just 'orange' to be replayed, got %v", replayed)
+	}
+}
@@ -0,0 +1,84 @@
+package wal
+
+import (
+	"fmt"
+	"github.com/losmonos/stork/src/go/smap"
+	"github.com/losmonos/stork/src/go/smap/redblack"
+)
+
+//Memtable is a RedBlack which mutations are appended to a Log before being applied,
+//so it can be rebuilt after a restart. Like RedBlack, it is not safe for concurrent use.
+//Reads go straight to the embedded RedBlack.
+type Memtable struct {
+	*redblack.RedBlack
+	log *Log
+}
+
+//OpenMemtable opens the Log in dir and rebuilds the RedBlack by replaying it.
+//Logs holding merges can't be replayed, as a Memtable has no MergeOperator.
+func OpenMemtable(dir string, m *redblack.RedBlack, opts Options) (*Memtable, error) {
+	log, err := Open(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := log.Replay(func(r Record) error { return apply(m, r) }); err != nil {
+		log.Close()
+		return nil, err
+	}
+	return &Memtable{m, log}, nil
+}
+
+//apply performs a logged mutation on a map, returning an error for the ones it doesn't handle.
+func apply(m smap.SMap, r Record) error {
+	switch r.Op {
+	case OpPut:
+		m.Put(r.Key, r.Value)
+	case OpDelete:
+		m.Delete(r.Key)
+	case OpBatch:
+		r.Batch.ApplyTo(m)
+	default:
+		return fmt.Errorf("wal: can't replay the record of op %d on a Memtable", r.Op)
+	}
+	return nil
+}
+
+//Put logs and then stores a value identified by a key.
+//Nothing is stored if the value couldn't be logged.
+func (m *Memtable) Put(key smap.Key, value smap.Value) error {
+	if err := m.log.Put(key, value); err != nil {
+		return err
+	}
+	m.RedBlack.Put(key, value)
+	return nil
+}
+
+//Delete logs and then removes a key, returning the value it held
+//and a boolean indicating if it was found.
+func (m *Memtable) Delete(key smap.Key) (v smap.Value, found bool, err error) {
+	if err = m.log.Delete(key); err != nil {
+		return nil, false, err
+	}
+	v, found = m.RedBlack.Delete(key)
+	return v, found, nil
+}
+
+//Apply logs and then performs all the operations of a batch, in order.
+//Nothing is applied if the batch couldn't be logged.
+func (m *Memtable) Apply(b *smap.Batch) error {
+	if err := m.log.Batch(b); err != nil {
+		return err
+	}
+	b.ApplyTo(m.RedBlack)
+	return nil
+}
+
+//Sync flushes the logged mutations to stable storage.
+func (m *Memtable) Sync() error {
+	return m.log.Sync()
+}
+
+//Close syncs and closes the underlying Log.
+func (m *Memtable) Close() error {
+	return m.log.Close()
+}
@@ -0,0 +1,149 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/losmonos/stork/src/go/smap"
+	"hash/crc32"
+)
+
+//Op is the kind of mutation a record holds.
+type Op byte
+
+const (
+	OpPut    Op = 1
+	OpDelete Op = 2
+	OpBatch  Op = 3
+	OpMerge  Op = 4
+)
+
+//Record is a single mutation in the log. Value is nil for deletes, and the operand for merges.
+//Batch records hold a whole smap.Batch instead of a Key and a Value.
+type Record struct {
+	Op    Op
+	Key   smap.Key
+	Value smap.Value
+	Batch *smap.Batch
+}
+
+//headerSize is the size of the crc and length prefix of every record.
+const headerSize = 8
+
+var (
+	//ErrCorrupt is returned when a record fails its checksum anywhere but at the tail of the log.
+	ErrCorrupt = errors.New("wal: corrupt record")
+	//errTorn signals a record that was not completely written or fails its checksum.
+	errTorn = errors.New("wal: torn record")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+//encode serializes a record, header included.
+func (r *Record) encode(codec smap.Codec) ([]byte, error) {
+	if r.Op == OpBatch {
+		return r.encodeBatch(codec)
+	}
+	key, err := codec.EncodeKey(r.Key)
+	if err != nil {
+		return nil, err
+	}
+	var value []byte
+	if r.Op == OpPut || r.Op == OpMerge {
+		if value, err = codec.EncodeValue(r.Value); err != nil {
+			return nil, err
+		}
+	}
+	buf := make([]byte, headerSize+1+binary.MaxVarintLen64+len(key)+len(value))
+	n := headerSize
+	buf[n] = byte(r.Op)
+	n++
+	n += binary.PutUvarint(buf[n:], uint64(len(key)))
+	n += copy(buf[n:], key)
+	n += copy(buf[n:], value)
+	return seal(buf[:n]), nil
+}
+
+//encodeBatch serializes a batch record, header included.
+func (r *Record) encodeBatch(codec smap.Codec) ([]byte, error) {
+	batch, err := r.Batch.Marshal(codec)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, headerSize+1, headerSize+1+len(batch))
+	buf[headerSize] = byte(OpBatch)
+	return seal(append(buf, batch...)), nil
+}
+
+//seal fills in the header of a record, given the record with room for it.
+func seal(buf []byte) []byte {
+	payload := buf[headerSize:]
+	binary.LittleEndian.PutUint32(buf[0:4], crc32.Checksum(payload, crcTable))
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(len(payload)))
+	return buf
+}
+
+//decode parses a record payload, as checked by readRecord.
+func decode(payload []byte, codec smap.Codec) (Record, error) {
+	var r Record
+	if len(payload) < 1 {
+		return r, ErrCorrupt
+	}
+	r.Op = Op(payload[0])
+	if r.Op == OpBatch {
+		var err error
+		if r.Batch, err = smap.UnmarshalBatch(payload[1:], codec); err == smap.ErrInvalidBatch {
+			err = ErrCorrupt
+		}
+		return r, err
+	}
+	keyLen, n := binary.Uvarint(payload[1:])
+	if n <= 0 || uint64(len(payload)-1-n) < keyLen {
+		return r, ErrCorrupt
+	}
+	rest := payload[1+n:]
+	var err error
+	if r.Key, err = codec.DecodeKey(rest[:keyLen]); err != nil {
+		return r, err
+	}
+	switch r.Op {
+	case OpPut, OpMerge:
+		r.Value, err = codec.DecodeValue(rest[keyLen:])
+	case OpDelete:
+	default:
+		err = ErrCorrupt
+	}
+	return r, err
+}
+
+//followedByRecord tells whether the bad record at the start of data, as reported by nextRecord,
+//is followed by a valid one. Torn writes only happen at the end of a segment, so they never are.
+func followedByRecord(data []byte) bool {
+	if len(data) < headerSize {
+		return false
+	}
+	length := binary.LittleEndian.Uint32(data[4:8])
+	if uint64(length) >= uint64(len(data)-headerSize) {
+		return false
+	}
+	_, _, err := nextRecord(data[headerSize+int(length):])
+	return err == nil
+}
+
+//nextRecord parses the record at the start of data, which holds the rest of a segment.
+//It returns the record payload and the record length, header included.
+//It returns errTorn if the record is incomplete or doesn't match its checksum.
+func nextRecord(data []byte) ([]byte, int, error) {
+	if len(data) < headerSize {
+		return nil, 0, errTorn
+	}
+	crc := binary.LittleEndian.Uint32(data[0:4])
+	length := binary.LittleEndian.Uint32(data[4:8])
+	if uint64(length) > uint64(len(data)-headerSize) {
+		return nil, 0, errTorn
+	}
+	payload := data[headerSize : headerSize+int(length)]
+	if crc32.Checksum(payload, crcTable) != crc {
+		return nil, 0, errTorn
+	}
+	return payload, headerSize + int(length), nil
+}